@@ -6,16 +6,27 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/controllers"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/eddn"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/facades"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/frontier"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/migrations"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/rules"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
@@ -52,20 +63,74 @@ func (app *Application) Server() (*gin.Engine, error) {
 	dm := app.Modules[discord.MODULE_NAME].(*discord.DiscordModule)
 	um := app.Modules[users.MODULE_NAME].(*users.UserModule)
 	tm := app.Modules[tokens.MODULE_NAME].(*tokens.TokenModule)
-	facade := facades.NewCoreFacade(app.Db, um, dm, tm, app.Config)
+	fm := app.Modules[frontier.MODULE_NAME].(*frontier.FrontierModule)
+	rm := app.Modules[rules.MODULE_NAME].(*rules.RuleModule)
+	jm := app.Modules[journal.MODULE_NAME].(*journal.JournalModule)
+	fcm := app.Modules[factions.MODULE_NAME].(*factions.FactionModule)
+	om := app.Modules[ops.MODULE_NAME].(*ops.OpsModule)
+	facade := facades.NewCoreFacade(app.Db, um, dm, fm, tm, rm, jm, fcm, om, app.Config)
 	ctrl := controllers.CoreController{
 		Facade: facade,
 		Config: app.Config,
 	}
 	r := gin.Default()
+	r.GET("/.well-known/jwks.json", ctrl.Jwks)
 	v1 := r.Group("/v1")
 	v1.Use(otelgin.Middleware("v1"))
+	v1.Use(ctrl.Authentication())
 	v1.GET("/login/discord", ctrl.LoginDiscord)
-	v1.GET("/users/current", ctrl.CurrentUser)
+	v1.POST("/discord/interactions", ctrl.DiscordInteractions)
+	v1.GET("/login/frontier", ctrl.LoginFrontier)
+	v1.POST("/tokens/refresh", ctrl.RefreshToken)
+	v1.POST("/logout", ctrl.Logout)
+	v1.POST("/logout/all", ctrl.LogoutAll)
+	v1.GET("/users/current", controllers.RequireScope(tokens.SCOPE_USERS_READ), controllers.RequireAuth(), ctrl.CurrentUser)
+	v1.GET("/users/current/sessions", ctrl.Sessions)
+	v1.DELETE("/users/current/sessions/:id", ctrl.KillSession)
+	v1.DELETE("/users/current/discord", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAuth(), ctrl.UnlinkDiscord)
+	v1.POST("/users/:id/merge", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAdmin(), ctrl.MergeUsers)
+	v1.DELETE("/principals/:id/tokens", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAdmin(), ctrl.RevokePrincipalTokens)
+	v1.GET("/principals/:id/audit", controllers.RequireScope(tokens.SCOPE_USERS_READ), controllers.RequireAdmin(), ctrl.PrincipalAudit)
+	v1.GET("/rules", controllers.RequireScope(tokens.SCOPE_USERS_READ), controllers.RequireAdmin(), ctrl.RoleRules)
+	v1.POST("/rules", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAdmin(), ctrl.CreateRoleRule)
+	v1.POST("/rules/dryrun", controllers.RequireScope(tokens.SCOPE_USERS_READ), controllers.RequireAdmin(), ctrl.DryRunRoleRules)
+	v1.DELETE("/rules/:id", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAdmin(), ctrl.DeleteRoleRule)
+	v1.POST("/oauth/introspect", ctrl.Introspect)
+	v1.GET("/apikeys", ctrl.ApiKeys)
+	v1.POST("/apikeys", ctrl.CreateApiKey)
+	v1.DELETE("/apikeys/:id", ctrl.RevokeApiKey)
+	v1.POST("/journal", controllers.RequireScope(tokens.SCOPE_JOURNAL_WRITE), ctrl.UploadJournal)
+	v1.GET("/factions", ctrl.Factions)
+	v1.GET("/factions/:id", ctrl.Faction)
+	v1.POST("/factions", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.CreateFaction)
+	v1.PUT("/factions/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.UpdateFaction)
+	v1.DELETE("/factions/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.DeleteFaction)
+	v1.GET("/factions/:id/influence", ctrl.InfluenceHistory)
+	v1.GET("/factions/:id/influence/drops", ctrl.InfluenceDrops)
+	v1.POST("/factions/:id/influence", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), ctrl.IngestInfluence)
+	v1.GET("/factions/:id/reports/:tick", ctrl.FactionReport)
+	v1.GET("/factions/:id/conflicts", ctrl.FactionConflicts)
+	v1.GET("/ticks", ctrl.Ticks)
+	v1.GET("/conflicts/active", ctrl.ActiveConflicts)
+	v1.POST("/conflicts", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), ctrl.SubmitConflicts)
+	v1.PUT("/conflicts/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.OverrideConflict)
+	v1.GET("/ops", controllers.RequireScope(tokens.SCOPE_FACTIONS_READ), controllers.RequireAuth(), ctrl.Ops)
+	v1.GET("/ops/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_READ), controllers.RequireAuth(), ctrl.Op)
+	v1.GET("/users/current/ops", controllers.RequireScope(tokens.SCOPE_USERS_READ), controllers.RequireAuth(), ctrl.UserOps)
+	v1.POST("/ops", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.CreateOp)
+	v1.PUT("/ops/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.UpdateOp)
+	v1.DELETE("/ops/:id", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.CancelOp)
+	v1.POST("/ops/:id/report", controllers.RequireScope(tokens.SCOPE_FACTIONS_WRITE), controllers.RequireAdmin(), ctrl.CompleteOp)
+	v1.POST("/ops/:id/signup", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireState(items.StateApproved), ctrl.SignUp)
+	v1.DELETE("/ops/:id/signup", controllers.RequireScope(tokens.SCOPE_USERS_WRITE), controllers.RequireAuth(), ctrl.Withdraw)
 	return r, nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
 	env := requireEnv("CEC_ENVIRONMENT")
 	cecdb := requireEnv("CEC_DB")
 	jaeger := requireEnv("CEC_JAEGER")
@@ -73,11 +138,29 @@ func main() {
 	authext := requireEnv("CEC_AUTH_EXTERNAL")
 	authint := requireEnv("CEC_AUTH_INTERNAL")
 	listenport := requireEnv("CEC_LISTENPORT")
+	accessttl := durationEnv("CEC_TOKEN_TTL", time.Hour)
+	refreshttl := durationEnv("CEC_REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	tokenkeys := parseTokenKeys(requireEnv("CEC_TOKEN_KEYS"))
+	jwtkeys := parseJwtKeys(os.Getenv("CEC_JWT_KEYS"))
+	services := parseServiceCredentials(os.Getenv("CEC_SERVICE_CREDENTIALS"))
+	discordrefresh := durationEnv("CEC_DISCORD_REFRESH_INTERVAL", 10*time.Minute)
+	discordresync := durationEnv("CEC_DISCORD_RESYNC_INTERVAL", 24*time.Hour)
+	frontierrefresh := durationEnv("CEC_FRONTIER_REFRESH_INTERVAL", 10*time.Minute)
+	frontiersync := durationEnv("CEC_FRONTIER_SYNC_INTERVAL", 6*time.Hour)
+	discordguilds := parseList(os.Getenv("CEC_DISCORD_GUILDS"))
+	opsreminder := durationEnv("CEC_OPS_REMINDER", time.Hour)
 	ctx, cancel := context.WithCancel(context.Background())
 	db, err := pgxpool.Connect(ctx, cecdb)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		log.Fatalln(err)
+	}
 	port, err := strconv.Atoi(listenport)
 	if err != nil {
 		log.Fatalln(err)
@@ -91,6 +174,31 @@ func main() {
 			AuthSecret:      authsecret,
 			AuthInternalUrl: authint,
 			AuthExternalUrl: authext,
+			AccessTokenTTL:  accessttl,
+			RefreshTokenTTL: refreshttl,
+			TokenKeys:       tokenkeys,
+			JwtKeys:         jwtkeys,
+			JwtIssuer:       APPLICATION_NAME,
+
+			ServiceCredentials: services,
+
+			DiscordClientId:        os.Getenv("CEC_DISCORD_CLIENT_ID"),
+			DiscordClientSecret:    os.Getenv("CEC_DISCORD_CLIENT_SECRET"),
+			DiscordRefreshInterval: discordrefresh,
+			DiscordResyncInterval:  discordresync,
+			DiscordGuilds:          discordguilds,
+			DiscordBotToken:        os.Getenv("CEC_DISCORD_BOT_TOKEN"),
+			DiscordPublicKey:       os.Getenv("CEC_DISCORD_PUBLIC_KEY"),
+
+			FrontierClientId:        os.Getenv("CEC_FRONTIER_CLIENT_ID"),
+			FrontierClientSecret:    os.Getenv("CEC_FRONTIER_CLIENT_SECRET"),
+			FrontierRefreshInterval: frontierrefresh,
+			FrontierSyncInterval:    frontiersync,
+
+			EddnRelay: os.Getenv("CEC_EDDN_RELAY"),
+
+			OpsWebhook:  os.Getenv("CEC_OPS_WEBHOOK"),
+			OpsReminder: opsreminder,
 		},
 	}
 	app.Tracer, err = tracer.SetupTracing(&tracer.TracerConfig{
@@ -106,9 +214,27 @@ func main() {
 	pm := principal.NewPrincipalModule()
 	app.Modules[principal.MODULE_NAME] = pm
 	app.Modules[users.MODULE_NAME] = users.NewUserModule(pm)
-	app.Modules[discord.MODULE_NAME] = discord.NewDiscordModule(nil)
-	app.Modules[tokens.MODULE_NAME] = tokens.NewTokenModule()
+	dm := discord.NewDiscordModule(nil, db, app.Config)
+	app.Modules[discord.MODULE_NAME] = dm
+	app.Modules[frontier.MODULE_NAME] = frontier.NewFrontierModule(nil, db, app.Config)
+	app.Modules[journal.MODULE_NAME] = journal.NewJournalModule()
+	fcm := factions.NewFactionModule(db)
+	app.Modules[factions.MODULE_NAME] = fcm
+	app.Modules[eddn.MODULE_NAME] = eddn.NewEddnModule(fcm, db, app.Config)
+	app.Modules[ops.MODULE_NAME] = ops.NewOpsModule(nil, db, app.Config)
+	rm := rules.NewRuleModule(dm, app.Config)
+	app.Modules[rules.MODULE_NAME] = rm
+	// re-evaluate role rules whenever guild roles are resynced
+	dm.OnSync(func(ctx context.Context, userId uint64, tx pgx.Tx) error {
+		_, err := rm.Apply(ctx, userId, tx)
+		return err
+	})
+	tm := tokens.NewTokenModule(app.Config)
+	app.Modules[tokens.MODULE_NAME] = tm
 	app.Start()
+	if err := tm.HashLegacyTokens(ctx, db); err != nil {
+		log.Fatalln(err)
+	}
 	server, err := app.Server()
 	if err != nil {
 		log.Fatalln(err)
@@ -121,6 +247,53 @@ func main() {
 	}
 }
 
+// Usage: cec-core migrate status|up|down [n]
+func migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatalln("usage: migrate status|up|down [n]")
+	}
+	ctx := context.Background()
+	db, err := pgxpool.Connect(ctx, requireEnv("CEC_DB"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	switch args[0] {
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, st := range list {
+			applied := "pending"
+			if st.AppliedOn != nil {
+				applied = st.AppliedOn.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Migration.Version, st.Migration.Name, applied)
+		}
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		err = migrator.Down(ctx, n)
+	default:
+		log.Fatalln("unknown migrate command", args[0])
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
 func requireEnv(name string) string {
 	value := os.Getenv(name)
 	if value == "" {
@@ -128,3 +301,72 @@ func requireEnv(name string) string {
 	}
 	return value
 }
+
+func durationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalln("variable", name, "is not a duration:", err)
+	}
+	return d
+}
+
+// Parse "id:secret,id:secret" list of token keys, current key first.
+func parseTokenKeys(value string) []config.TokenKey {
+	out := make([]config.TokenKey, 0)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalln("variable CEC_TOKEN_KEYS must be a list of id:secret")
+		}
+		out = append(out, config.TokenKey{Id: parts[0], Secret: parts[1]})
+	}
+	return out
+}
+
+// Parse "kid:path,kid:path" list of JWT signing keys, current key first.
+func parseJwtKeys(value string) []config.JwtKey {
+	out := make([]config.JwtKey, 0)
+	if value == "" {
+		return out
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalln("variable CEC_JWT_KEYS must be a list of kid:path")
+		}
+		out = append(out, config.JwtKey{Id: parts[0], Path: parts[1]})
+	}
+	return out
+}
+
+// Parse "name:secret,name:secret" list of service credentials.
+func parseServiceCredentials(value string) map[string]string {
+	out := map[string]string{}
+	if value == "" {
+		return out
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalln("variable CEC_SERVICE_CREDENTIALS must be a list of name:secret")
+		}
+		out[parts[0]] = parts[1]
+	}
+	return out
+}
+
+// Parse comma separated list, skipping empty items.
+func parseList(value string) []string {
+	out := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -1,6 +1,8 @@
 package httpapi
 
 import (
+	"time"
+
 	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
 )
 
@@ -24,6 +26,169 @@ type AuthPhaseResult struct {
 	// token
 	Token string `json:"token,omitempty"`
 
+	// refresh token
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// token expiration time
+	Expires *time.Time `json:"expires,omitempty"`
+
 	// user
 	User *items.User `json:"user,omitempty"`
 }
+
+type RefreshRequest struct {
+
+	// refresh token
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ApiKeyRequest struct {
+
+	// name of the key
+	Name string `json:"name" binding:"required,max=64"`
+
+	// scopes allowed to the key
+	Scopes []string `json:"scopes" binding:"required"`
+
+	// optional expiration time
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// RFC 7662 introspection response
+type IntrospectionResult struct {
+	Active bool `json:"active"`
+
+	// space separated scopes
+	Scope string `json:"scope,omitempty"`
+
+	// token kind: access_token or api_key
+	TokenType string `json:"token_type,omitempty"`
+
+	// expiration time, unix seconds
+	Exp int64 `json:"exp,omitempty"`
+
+	// principal id
+	Sub string `json:"sub,omitempty"`
+
+	PrincipalId uint64 `json:"principal_id,omitempty"`
+	UserId      uint64 `json:"user_id,omitempty"`
+	Admin       bool   `json:"admin,omitempty"`
+	State       string `json:"state,omitempty"`
+}
+
+type MergeRequest struct {
+
+	// user to merge and block
+	SourceUserId uint64 `json:"source_user_id" binding:"required"`
+}
+
+type RoleRuleRequest struct {
+
+	// discord guild id, must be listed in CEC_DISCORD_GUILDS
+	GuildId string `json:"guild_id" binding:"required"`
+
+	// role to match, empty matches any member
+	RoleId string `json:"role_id,omitempty"`
+
+	// match users who are not members of the guild
+	Absent bool `json:"absent,omitempty"`
+
+	// admin or state
+	Effect string `json:"effect" binding:"required"`
+
+	// state to set for state effect
+	State string `json:"state,omitempty"`
+
+	// rules with lower priority are checked first
+	Priority int `json:"priority,omitempty"`
+}
+
+type DryRunRequest struct {
+
+	// candidate rules to evaluate instead of stored ones
+	Rules []*RoleRuleRequest `json:"rules,omitempty"`
+}
+
+type FactionRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Allegiance string `json:"allegiance" binding:"required"`
+	Government string `json:"government" binding:"required"`
+
+	// system the faction is native to
+	HomeSystem string `json:"home_system,omitempty"`
+
+	// faction is supported by our squadron
+	SquadronSupported bool `json:"squadron_supported,omitempty"`
+}
+
+type InfluenceRequest struct {
+	System string `json:"system" binding:"required"`
+
+	// start of the BGS tick the numbers belong to
+	Tick time.Time `json:"tick" binding:"required"`
+
+	// fraction of system influence, 0..1
+	Influence        float64  `json:"influence"`
+	Happiness        string   `json:"happiness,omitempty"`
+	ActiveStates     []string `json:"active_states,omitempty"`
+	PendingStates    []string `json:"pending_states,omitempty"`
+	RecoveringStates []string `json:"recovering_states,omitempty"`
+}
+
+type ConflictSideRequest struct {
+	Name    string `json:"name"`
+	Stake   string `json:"stake,omitempty"`
+	WonDays int    `json:"won_days"`
+}
+
+type ConflictRequest struct {
+	WarType string `json:"war_type" binding:"required"`
+
+	// pending, active or empty when the conflict is over
+	Status   string              `json:"status"`
+	Faction1 ConflictSideRequest `json:"faction1"`
+	Faction2 ConflictSideRequest `json:"faction2"`
+}
+
+// Conflicts of system as seen in its snapshot
+type ConflictsRequest struct {
+	System    string             `json:"system" binding:"required"`
+	Observed  time.Time          `json:"observed" binding:"required"`
+	Conflicts []*ConflictRequest `json:"conflicts"`
+}
+
+type ConflictOverrideRequest struct {
+	Status   string              `json:"status" binding:"required"`
+	Faction1 ConflictSideRequest `json:"faction1"`
+	Faction2 ConflictSideRequest `json:"faction2"`
+
+	// winner name or draw, decided by won days when empty
+	Outcome string `json:"outcome,omitempty"`
+
+	// keep conflict as set, true when omitted
+	Manual *bool `json:"manual,omitempty"`
+}
+
+type OpRequest struct {
+	Title string `json:"title" binding:"required"`
+
+	// bgs, mining or combat
+	Kind      string    `json:"kind" binding:"required"`
+	FactionId *uint64   `json:"faction_id,omitempty"`
+	System    string    `json:"system,omitempty"`
+	Objective string    `json:"objective" binding:"required"`
+	Starts    time.Time `json:"starts" binding:"required"`
+	Ends      time.Time `json:"ends" binding:"required"`
+
+	// most members who can sign up, 0 for no limit
+	Capacity int `json:"capacity,omitempty"`
+}
+
+type OpReportRequest struct {
+	// success, partial or failed
+	Outcome string `json:"outcome" binding:"required"`
+	Summary string `json:"summary,omitempty"`
+
+	// ids of signed up users who took part
+	Attended []uint64 `json:"attended,omitempty"`
+}
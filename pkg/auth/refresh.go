@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tokens expiring sooner than that are refreshed
+const REFRESH_MARGIN = time.Hour
+
+// Exchange refresh token for a new oauth token.
+type RefreshFunc func(ctx context.Context, refreshToken string) (*OauthToken, error)
+
+// Background refresh of oauth tokens of accounts stored in table, which has
+// id, access_token, token_type, token_expires_in, refresh_token,
+// reauth_required, refresh_attempted and updated columns.
+func NewTokenRefresher(name string, table string, refresh RefreshFunc, errReauth error, db *pgxpool.Pool) *TokenRefresher {
+	return &TokenRefresher{
+		name:      name,
+		table:     table,
+		refresh:   refresh,
+		errReauth: errReauth,
+		db:        db,
+	}
+}
+
+type TokenRefresher struct {
+	// provider name for spans and logs
+	name    string
+	table   string
+	refresh RefreshFunc
+	// returned by refresh when the refresh token was rejected
+	errReauth error
+	db        *pgxpool.Pool
+}
+
+// Store new token info of account and clear reauth flag.
+func (r *TokenRefresher) UpdateTokens(ctx context.Context, id uint64, token *OauthToken, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE `+r.table+` SET
+		access_token = $2,
+		token_type = $3,
+		token_expires_in = $4,
+		refresh_token = $5,
+		reauth_required = false,
+		refresh_attempted = NULL,
+		updated = now()
+	WHERE id = $1
+	`, id, token.AccessToken, token.TokenType, token.Expiry, token.RefreshToken)
+	return err
+}
+
+// Run RefreshExpiring every interval until ctx is done.
+func (r *TokenRefresher) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := r.RefreshExpiring(ctx)
+		if err != nil {
+			log.Printf("%s token refresh: %s\n", r.name, err)
+		} else if n > 0 {
+			log.Printf("%s tokens refreshed: %d\n", r.name, n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh tokens of every account expiring soon. Accounts are locked
+// one by one, so several replicas can run it at once. Accounts failing
+// to refresh are tried again on the next run.
+func (r *TokenRefresher) RefreshExpiring(ctx context.Context) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, r.name+".refresh_expiring", nil)
+	defer span.End()
+	started := time.Now()
+	count := 0
+	for {
+		done, refreshed, err := r.refreshNext(ctx, started)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "refresh error")
+			return count, err
+		}
+		if done {
+			return count, nil
+		}
+		if refreshed {
+			count++
+		}
+	}
+}
+
+func (r *TokenRefresher) refreshNext(ctx context.Context, started time.Time) (bool, bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback(ctx)
+	var (
+		id      uint64
+		refresh string
+	)
+	err = tx.QueryRow(ctx, `
+	SELECT id, refresh_token FROM `+r.table+`
+	WHERE NOT reauth_required AND token_expires_in < $1
+	AND (refresh_attempted IS NULL OR refresh_attempted < $2)
+	ORDER BY token_expires_in
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+	`, time.Now().Add(REFRESH_MARGIN), started).Scan(&id, &refresh)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	span := tracer.SpanFromContext(ctx)
+	token, err := r.refresh(ctx, refresh)
+	if errors.Is(err, r.errReauth) {
+		span.AddEvent("reauth required", trace.WithAttributes(
+			attribute.Int64(r.name+".id", int64(id)),
+		))
+		_, err = tx.Exec(ctx, `
+		UPDATE `+r.table+` SET reauth_required = true, updated = now()
+		WHERE id = $1
+		`, id)
+		if err != nil {
+			return false, false, err
+		}
+		return false, false, tx.Commit(ctx)
+	}
+	if err != nil {
+		// mark as attempted and go on, so one failing account
+		// does not hold back the others
+		log.Printf("%s token refresh of account %v: %s\n", r.name, id, err)
+		tracer.AddSpanError(span, err)
+		_, err = tx.Exec(ctx, `
+		UPDATE `+r.table+` SET refresh_attempted = $2 WHERE id = $1
+		`, id, time.Now())
+		if err != nil {
+			return false, false, err
+		}
+		return false, false, tx.Commit(ctx)
+	}
+	if err = r.UpdateTokens(ctx, id, token, tx); err != nil {
+		return false, false, err
+	}
+	return false, true, tx.Commit(ctx)
+}
@@ -0,0 +1,246 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Every API key starts with it, followed by key prefix and secret:
+// cec_<prefix>_<secret>
+const APIKEY_PREFIX = "cec_"
+
+const (
+	SCOPE_USERS_READ     = "users:read"
+	SCOPE_USERS_WRITE    = "users:write"
+	SCOPE_FACTIONS_READ  = "factions:read"
+	SCOPE_FACTIONS_WRITE = "factions:write"
+	SCOPE_JOURNAL_WRITE  = "journal:write"
+)
+
+var SCOPES = []string{
+	SCOPE_USERS_READ,
+	SCOPE_USERS_WRITE,
+	SCOPE_FACTIONS_READ,
+	SCOPE_FACTIONS_WRITE,
+	SCOPE_JOURNAL_WRITE,
+}
+
+var (
+	ErrScope         = errors.New("insufficient scope")
+	ErrUnknownScope  = errors.New("unknown scope")
+	ErrApiKeyMissing = errors.New("api key not found")
+)
+
+// Principal authorized by an access token or an API key.
+type Grant struct {
+	PrincipalId uint64
+	// zero for access tokens
+	ApiKeyId uint64
+	// scopes of API key, access tokens are not limited
+	Scopes  []string
+	Expires *time.Time
+}
+
+func (g *Grant) Allows(scope string) bool {
+	if g.ApiKeyId == 0 {
+		return true
+	}
+	for _, s := range g.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes granted, access tokens are granted every scope.
+func (g *Grant) Granted() []string {
+	if g.ApiKeyId == 0 {
+		return SCOPES
+	}
+	return g.Scopes
+}
+
+func ValidScope(scope string) bool {
+	for _, s := range SCOPES {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve access token or API key.
+func (m *TokenModule) Resolve(ctx context.Context, db api.DbConn, token string) (*Grant, error) {
+	if strings.HasPrefix(token, APIKEY_PREFIX) {
+		return m.findApiKey(ctx, db, token)
+	}
+	return m.findAccessToken(ctx, db, token)
+}
+
+// Resolve access token or API key and check that it allows scope.
+func (m *TokenModule) Authorize(ctx context.Context, db api.DbConn, token string, scope string) (*Grant, error) {
+	ctx, span := tracer.NewSpan(ctx, "tokens.authorize", nil)
+	defer span.End()
+	grant, err := m.Resolve(ctx, db, token)
+	if err != nil {
+		return nil, err
+	}
+	if !grant.Allows(scope) {
+		span.AddEvent("scope denied")
+		return nil, ErrScope
+	}
+	return grant, nil
+}
+
+func (m *TokenModule) findApiKey(ctx context.Context, db api.DbConn, key string) (*Grant, error) {
+	span := tracer.SpanFromContext(ctx)
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKEY_PREFIX), "_", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	span.SetAttributes(attribute.String("apikey.prefix", parts[0]))
+	grant := &Grant{}
+	var keyId string
+	err := db.QueryRow(ctx, `
+	SELECT id, principal_id, scopes, expires, key_id FROM api_keys
+	WHERE prefix = $1 AND key_hash = ANY($2) AND revoked IS NULL
+	AND (expires IS NULL OR expires > now())
+	`, parts[0], m.candidates(key)).Scan(&grant.ApiKeyId, &grant.PrincipalId, &grant.Scopes, &grant.Expires, &keyId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	_, err = db.Exec(ctx, `
+	UPDATE api_keys SET last_used = now()
+	WHERE id = $1 AND (last_used IS NULL OR last_used < now() - interval '1 minute')
+	`, grant.ApiKeyId)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.rehash(ctx, db, "api_keys", "key_hash", grant.ApiKeyId, keyId, key); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Create API key for principal. Returned item carries the full key.
+func (m *TokenModule) NewApiKey(ctx context.Context, pid uint64, name string, scopes []string, expires *time.Time, tx pgx.Tx) (*items.ApiKey, error) {
+	ctx, span := tracer.NewSpan(ctx, "tokens.new_apikey", nil)
+	defer span.End()
+	for _, s := range scopes {
+		if !ValidScope(s) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, s)
+		}
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	prefix := hex.EncodeToString(b)
+	secret := make([]byte, TOKEN_SIZE)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s%s_%s", APIKEY_PREFIX, prefix, base64.RawURLEncoding.EncodeToString(secret))
+	now := time.Now()
+	out := &items.ApiKey{
+		Name:    name,
+		Prefix:  prefix,
+		Scopes:  scopes,
+		Created: &now,
+		Expires: expires,
+		Key:     key,
+	}
+	hmacKey := m.currentKey()
+	err := tx.QueryRow(ctx, `
+	INSERT INTO api_keys (
+		principal_id, name, prefix, key_hash, key_id, scopes, created, expires
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`, pid, name, prefix, digest(hmacKey, key), hmacKey.Id, scopes, now, expires).Scan(&out.Id)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	return out, nil
+}
+
+// List API keys of principal that are not revoked.
+func (m *TokenModule) ApiKeys(ctx context.Context, pid uint64, db api.DbConn) ([]*items.ApiKey, error) {
+	ctx, span := tracer.NewSpan(ctx, "tokens.apikeys", nil)
+	defer span.End()
+	out := make([]*items.ApiKey, 0)
+	rows, err := db.Query(ctx, `
+	SELECT id, name, prefix, scopes, created, expires, last_used
+	FROM api_keys
+	WHERE principal_id = $1 AND revoked IS NULL
+	ORDER BY created DESC
+	`, pid)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key := &items.ApiKey{}
+		err = rows.Scan(
+			&key.Id,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.Created,
+			&key.Expires,
+			&key.LastUsed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *TokenModule) RevokeApiKey(ctx context.Context, pid uint64, id uint64, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `
+	UPDATE api_keys SET revoked = now()
+	WHERE id = $1 AND principal_id = $2 AND revoked IS NULL
+	`, id, pid)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrApiKeyMissing
+	}
+	return nil
+}
+
+// Revoke every API key of principal.
+func (m *TokenModule) RevokeApiKeys(ctx context.Context, pid uint64, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE api_keys SET revoked = now()
+	WHERE principal_id = $1 AND revoked IS NULL
+	`, pid)
+	return err
+}
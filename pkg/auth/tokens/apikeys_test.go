@@ -0,0 +1,24 @@
+package tokens
+
+import "testing"
+
+func TestGrantAllows(t *testing.T) {
+	login := &Grant{PrincipalId: 1}
+	for _, scope := range SCOPES {
+		if !login.Allows(scope) {
+			t.Errorf("login token denied %s", scope)
+		}
+	}
+	key := &Grant{PrincipalId: 1, ApiKeyId: 2, Scopes: []string{SCOPE_JOURNAL_WRITE}}
+	if !key.Allows(SCOPE_JOURNAL_WRITE) {
+		t.Error("api key denied its own scope")
+	}
+	for _, scope := range []string{SCOPE_USERS_READ, SCOPE_USERS_WRITE, SCOPE_FACTIONS_WRITE, ""} {
+		if key.Allows(scope) {
+			t.Errorf("api key allowed %q", scope)
+		}
+	}
+	if len(key.Granted()) != 1 || len(login.Granted()) != len(SCOPES) {
+		t.Errorf("unexpected granted scopes %v, %v", key.Granted(), login.Granted())
+	}
+}
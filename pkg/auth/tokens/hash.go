@@ -0,0 +1,123 @@
+package tokens
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func digest(key config.TokenKey, token string) string {
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Key used to hash new tokens.
+func (m *TokenModule) currentKey() config.TokenKey {
+	return m.keys[0]
+}
+
+// Hash of token under every known key, current key first.
+func (m *TokenModule) candidates(token string) []string {
+	out := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		out[i] = digest(key, token)
+	}
+	return out
+}
+
+// Move row of table, found by token hashed with a retired key,
+// to the current key. Rows already hashed by it are left alone.
+func (m *TokenModule) rehash(ctx context.Context, db api.DbConn, table string, column string, id uint64, keyId string, token string) error {
+	key := m.currentKey()
+	if keyId == key.Id {
+		return nil
+	}
+	_, err := db.Exec(ctx, fmt.Sprintf(`
+	UPDATE %s SET %s = $2, key_id = $3 WHERE id = $1
+	`, table, column), id, digest(key, token), key.Id)
+	if err != nil {
+		return err
+	}
+	tracer.SpanFromContext(ctx).AddEvent("token rehashed")
+	return nil
+}
+
+// Replace plaintext tokens left from before hashing was introduced
+// with their hashes. Sessions stay valid. Safe to run more than once.
+// Tokens and API keys hashed by retired keys are counted and logged.
+func (m *TokenModule) HashLegacyTokens(ctx context.Context, db *pgxpool.Pool) error {
+	ctx, span := tracer.NewSpan(ctx, "tokens.hash_legacy", nil)
+	defer span.End()
+	for _, table := range []string{"access_tokens", "refresh_tokens"} {
+		err := db.BeginFunc(ctx, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, fmt.Sprintf(`
+			SELECT id, token FROM %s WHERE token IS NOT NULL FOR UPDATE
+			`, table))
+			if err != nil {
+				return err
+			}
+			legacy := map[uint64]string{}
+			for rows.Next() {
+				var id uint64
+				var token string
+				if err := rows.Scan(&id, &token); err != nil {
+					rows.Close()
+					return err
+				}
+				legacy[id] = token
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			key := m.currentKey()
+			for id, token := range legacy {
+				_, err := tx.Exec(ctx, fmt.Sprintf(`
+				UPDATE %s SET token = NULL, token_hash = $2, key_id = $3
+				WHERE id = $1
+				`, table), id, digest(key, token), key.Id)
+				if err != nil {
+					return err
+				}
+			}
+			if len(legacy) > 0 {
+				span.AddEvent(fmt.Sprintf("hashed %v tokens in %s", len(legacy), table))
+			}
+			return nil
+		})
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "query error")
+			return err
+		}
+	}
+	// hashed tokens are rehashed only on use, report the live ones
+	// which still keep a retired key from being dropped
+	for _, table := range []string{"access_tokens", "refresh_tokens", "api_keys"} {
+		var count int
+		err := db.QueryRow(ctx, fmt.Sprintf(`
+		SELECT count(*) FROM %s
+		WHERE key_id <> $1 AND revoked IS NULL
+		AND (expires IS NULL OR expires > now())
+		`, table), m.currentKey().Id).Scan(&count)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "query error")
+			return err
+		}
+		if count > 0 {
+			log.Printf("%v live rows of %s are hashed by retired token keys\n", count, table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+)
+
+func TestCandidatesCurrentKeyFirst(t *testing.T) {
+	m := NewTokenModule(&config.Config{
+		TokenKeys: []config.TokenKey{
+			{Id: "new", Secret: "secret2"},
+			{Id: "old", Secret: "secret1"},
+		},
+	})
+	list := m.candidates("token")
+	if len(list) != 2 {
+		t.Fatalf("expected 2 candidates, got %v", len(list))
+	}
+	if list[0] != digest(m.currentKey(), "token") {
+		t.Error("first candidate is not hashed by current key")
+	}
+	if list[0] == list[1] {
+		t.Error("different keys produced same hash")
+	}
+	if list[0] == "token" {
+		t.Error("token is not hashed")
+	}
+}
@@ -0,0 +1,138 @@
+package tokens
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v4"
+)
+
+// Claims of JWT access tokens
+type Claims struct {
+	jwt.RegisteredClaims
+	PrincipalId uint64 `json:"pid"`
+	UserId      uint64 `json:"uid"`
+	Admin       bool   `json:"admin"`
+	State       string `json:"state"`
+}
+
+type jwtKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Public key in JWK format
+type Jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+// Read PKCS#8 PEM private keys, Ed25519 or RSA.
+func LoadJwtKeys(files []config.JwtKey) ([]*jwtKey, error) {
+	out := make([]*jwtKey, 0, len(files))
+	for _, f := range files {
+		raw, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return nil, fmt.Errorf("jwt key %s: no PEM data", f.Id)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", f.Id, err)
+		}
+		key := &jwtKey{id: f.Id}
+		switch k := parsed.(type) {
+		case ed25519.PrivateKey:
+			key.method = jwt.SigningMethodEdDSA
+			key.private = k
+		case *rsa.PrivateKey:
+			key.method = jwt.SigningMethodRS256
+			key.private = k
+		default:
+			return nil, fmt.Errorf("jwt key %s: unsupported key type %T", f.Id, parsed)
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+func (m *TokenModule) signJwt(ctx context.Context, pid uint64, expires time.Time, tx pgx.Tx) (string, error) {
+	key := m.jwtKeys[0]
+	claims := Claims{PrincipalId: pid}
+	err := tx.QueryRow(ctx, `
+	SELECT u.id, p.is_admin, p.state
+	FROM principals p
+	JOIN users u ON u.principal_id = p.id
+	WHERE p.id = $1
+	`, pid).Scan(&claims.UserId, &claims.Admin, &claims.State)
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    m.jwtIssuer,
+		Subject:   fmt.Sprint(pid),
+		ExpiresAt: jwt.NewNumericDate(expires),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        jti,
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// Public keys to verify JWT access tokens. Retired keys stay
+// published while tokens signed by them may still be alive.
+func (m *TokenModule) Jwks() *Jwks {
+	out := &Jwks{Keys: make([]Jwk, 0, len(m.jwtKeys))}
+	for _, key := range m.jwtKeys {
+		jwk := Jwk{
+			Kid: key.id,
+			Alg: key.method.Alg(),
+			Use: "sig",
+		}
+		switch pub := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		out.Keys = append(out.Keys, jwk)
+	}
+	return out
+}
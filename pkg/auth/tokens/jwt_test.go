@@ -0,0 +1,46 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+)
+
+func TestJwksPublishesEd25519Key(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJwtKeys([]config.JwtKey{{Id: "k1", Path: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &TokenModule{jwtKeys: keys}
+	jwks := m.Jwks()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected 1 key, got %v", len(jwks.Keys))
+	}
+	jwk := jwks.Keys[0]
+	if jwk.Kid != "k1" || jwk.Alg != "EdDSA" || jwk.Kty != "OKP" {
+		t.Errorf("unexpected jwk %+v", jwk)
+	}
+	if jwk.X != base64.RawURLEncoding.EncodeToString(pub) {
+		t.Error("published key does not match")
+	}
+}
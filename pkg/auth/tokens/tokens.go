@@ -4,8 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
 	"github.com/jackc/pgx/v4"
@@ -15,44 +20,398 @@ var MODULE_NAME = "tokens"
 
 const TOKEN_SIZE = 32
 
-func NewTokenModule() *TokenModule {
-	return &TokenModule{}
+// Reasons recorded for revoked tokens
+const (
+	REVOKE_LOGOUT        = "logout"
+	REVOKE_LOGOUT_ALL    = "logout_all"
+	REVOKE_ADMIN         = "admin"
+	REVOKE_REFRESH_REUSE = "refresh_reuse"
+	REVOKE_ROTATED       = "rotated"
+	REVOKE_SESSION       = "session"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenReused  = errors.New("refresh token reused")
+	ErrNoSession    = errors.New("session not found")
+)
+
+func NewTokenModule(cfg *config.Config) *TokenModule {
+	return &TokenModule{
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		keys:       cfg.TokenKeys,
+		jwtFiles:   cfg.JwtKeys,
+		jwtIssuer:  cfg.JwtIssuer,
+	}
 }
 
 type TokenModule struct {
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// HMAC keys for stored tokens, current key first
+	keys []config.TokenKey
+
+	// JWT access tokens are issued when keys are configured,
+	// first key signs new tokens
+	jwtFiles  []config.JwtKey
+	jwtKeys   []*jwtKey
+	jwtIssuer string
 }
 
 func (m *TokenModule) Start(ctx context.Context) error {
+	if len(m.keys) == 0 {
+		return fmt.Errorf("no token keys configured")
+	}
+	keys, err := LoadJwtKeys(m.jwtFiles)
+	if err != nil {
+		return err
+	}
+	m.jwtKeys = keys
 	return nil
 }
 
-func (m *TokenModule) NewToken(ctx context.Context, p *items.Principal, tx pgx.Tx) (string, error) {
+func randomToken() (string, error) {
 	b := make([]byte, TOKEN_SIZE)
-	rand.Read(b)
-	token := base64.RawStdEncoding.EncodeToString(b)
-	_, err := tx.Exec(ctx, `
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// Start a new session: access token and refresh token of a new family.
+func (m *TokenModule) NewToken(ctx context.Context, p *items.Principal, client *items.ClientInfo, tx pgx.Tx) (*items.TokenPair, error) {
+	var family uint64
+	err := tx.QueryRow(ctx, `SELECT nextval('refresh_token_families')`).Scan(&family)
+	if err != nil {
+		return nil, err
+	}
+	return m.issue(ctx, p.Id, family, client, tx)
+}
+
+func (m *TokenModule) issue(ctx context.Context, pid uint64, family uint64, client *items.ClientInfo, tx pgx.Tx) (*items.TokenPair, error) {
+	now := time.Now()
+	expires := now.Add(m.accessTTL)
+	var access string
+	var err error
+	if len(m.jwtKeys) > 0 {
+		access, err = m.signJwt(ctx, pid, expires, tx)
+	} else {
+		access, err = randomToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	key := m.currentKey()
+	_, err = tx.Exec(ctx, `
 	INSERT INTO access_tokens (
-		principal_id, token, expires
-	) VALUES ($1, $2, $3)
-	`, p.Id, token, nil)
+		principal_id, token_hash, key_id, expires, created, family,
+		ip, user_agent, provider
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, pid, digest(key, access), key.Id, expires, now, family,
+		client.IP, truncate(client.UserAgent, 512), client.Provider)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO refresh_tokens (
+		principal_id, family, token_hash, key_id, created, expires
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	`, pid, family, digest(key, refresh), key.Id, now, now.Add(m.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &items.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		Expires:      &expires,
+	}, nil
+}
+
+// Exchange refresh token for a new token pair. Refresh token is rotated:
+// presenting an already used one revokes the whole family and returns
+// ErrTokenReused, which must be committed by the caller.
+// Login provider is inherited from the previous access token.
+func (m *TokenModule) Refresh(ctx context.Context, refresh string, client *items.ClientInfo, tx pgx.Tx) (uint64, *items.TokenPair, error) {
+	ctx, span := tracer.NewSpan(ctx, "tokens.refresh", nil)
+	defer span.End()
+	var (
+		id      uint64
+		pid     uint64
+		family  uint64
+		expires time.Time
+		used    *time.Time
+		revoked *time.Time
+		keyId   string
+	)
+	err := tx.QueryRow(ctx, `
+	SELECT id, principal_id, family, expires, used, revoked, key_id
+	FROM refresh_tokens
+	WHERE token_hash = ANY($1)
+	FOR UPDATE
+	`, m.candidates(refresh)).Scan(&id, &pid, &family, &expires, &used, &revoked, &keyId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrInvalidToken
+		}
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return 0, nil, err
+	}
+	if revoked != nil || expires.Before(time.Now()) {
+		return 0, nil, ErrInvalidToken
+	}
+	// used tokens too, so reuse is still detected once the old key is dropped
+	if err = m.rehash(ctx, tx, "refresh_tokens", "token_hash", id, keyId, refresh); err != nil {
+		return 0, nil, err
+	}
+	if used != nil {
+		span.AddEvent("refresh token reuse detected")
+		if err := m.revokeFamily(ctx, family, REVOKE_REFRESH_REUSE, tx); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, ErrTokenReused
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE refresh_tokens SET used = now() WHERE id = $1
+	`, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	var provider *string
+	err = tx.QueryRow(ctx, `
+	SELECT provider FROM access_tokens
+	WHERE family = $1
+	ORDER BY created DESC
+	LIMIT 1
+	`, family).Scan(&provider)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, err
+	}
+	// previous access token is superseded by the new one
+	_, err = tx.Exec(ctx, `
+	UPDATE access_tokens SET revoked = now(), revoke_reason = $2
+	WHERE family = $1 AND revoked IS NULL
+	`, family, REVOKE_ROTATED)
+	if err != nil {
+		return 0, nil, err
+	}
+	next := *client
+	if provider != nil {
+		next.Provider = *provider
+	}
+	pair, err := m.issue(ctx, pid, family, &next, tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	return pid, pair, nil
+}
+
+func (m *TokenModule) revokeFamily(ctx context.Context, family uint64, reason string, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE refresh_tokens SET revoked = now(), revoke_reason = $2
+	WHERE family = $1 AND revoked IS NULL
+	`, family, reason)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE access_tokens SET revoked = now(), revoke_reason = $2
+	WHERE family = $1 AND revoked IS NULL
+	`, family, reason)
+	return err
+}
+
+// Revoke access token together with its refresh token family.
+func (m *TokenModule) Revoke(ctx context.Context, token string, reason string, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "tokens.revoke", nil)
+	defer span.End()
+	var family *uint64
+	err := tx.QueryRow(ctx, `
+	UPDATE access_tokens SET revoked = now(), revoke_reason = $2
+	WHERE token_hash = ANY($1) AND revoked IS NULL
+	RETURNING family
+	`, m.candidates(token), reason).Scan(&family)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return err
+	}
+	if family == nil {
+		return nil
 	}
-	return token, nil
+	return m.revokeFamily(ctx, *family, reason, tx)
+}
+
+// Revoke every access and refresh token of principal.
+func (m *TokenModule) RevokeAll(ctx context.Context, pid uint64, reason string, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "tokens.revoke_all", nil)
+	defer span.End()
+	_, err := tx.Exec(ctx, `
+	UPDATE access_tokens SET revoked = now(), revoke_reason = $2
+	WHERE principal_id = $1 AND revoked IS NULL
+	`, pid, reason)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE refresh_tokens SET revoked = now(), revoke_reason = $2
+	WHERE principal_id = $1 AND revoked IS NULL
+	`, pid, reason)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+	}
+	return err
 }
 
 func (m *TokenModule) FindPrincipalID(ctx context.Context, db api.DbConn, token string) (uint64, error) {
+	grant, err := m.findAccessToken(ctx, db, token)
+	if err != nil {
+		return 0, err
+	}
+	return grant.PrincipalId, nil
+}
+
+func (m *TokenModule) findAccessToken(ctx context.Context, db api.DbConn, token string) (*Grant, error) {
 	ctx, span := tracer.NewSpan(ctx, "tokens.find_principal_id", nil)
 	defer span.End()
-	var id uint64
+	var (
+		id    uint64
+		pid   uint64
+		keyId string
+	)
+	grant := &Grant{}
 	err := db.QueryRow(ctx, `
-		SELECT principal_id FROM access_tokens
-		WHERE token = $1 AND ((expires IS NOT NULL AND expires > now()) OR expires IS NULL)
-	`, token).Scan(&id)
+		SELECT id, principal_id, key_id, expires FROM access_tokens
+		WHERE token_hash = ANY($1) AND ((expires IS NOT NULL AND expires > now()) OR expires IS NULL)
+		AND revoked IS NULL
+	`, m.candidates(token)).Scan(&id, &pid, &keyId, &grant.Expires)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
 		tracer.AddSpanError(span, err)
 		tracer.FailSpan(span, "query error")
-		return 0, err
+		return nil, err
+	}
+	// throttled to keep reads cheap
+	_, err = db.Exec(ctx, `
+	UPDATE access_tokens SET last_used = now()
+	WHERE id = $1 AND (last_used IS NULL OR last_used < now() - interval '1 minute')
+	`, id)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	if err = m.rehash(ctx, db, "access_tokens", "token_hash", id, keyId, token); err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	grant.PrincipalId = pid
+	return grant, nil
+}
+
+// List active sessions of principal. Session of token is marked as current.
+func (m *TokenModule) Sessions(ctx context.Context, pid uint64, token string, db api.DbConn) ([]*items.Session, error) {
+	ctx, span := tracer.NewSpan(ctx, "tokens.sessions", nil)
+	defer span.End()
+	out := make([]*items.Session, 0)
+	rows, err := db.Query(ctx, `
+	SELECT a.id, a.created, a.last_used, a.expires, a.ip, a.user_agent, a.provider,
+		a.token_hash = ANY($2)
+	FROM access_tokens a
+	WHERE a.principal_id = $1 AND a.revoked IS NULL AND (
+		a.expires IS NULL OR a.expires > now() OR EXISTS (
+			SELECT 1 FROM refresh_tokens r
+			WHERE r.family = a.family AND r.revoked IS NULL
+			AND r.used IS NULL AND r.expires > now()
+		)
+	)
+	ORDER BY a.created DESC
+	`, pid, m.candidates(token))
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sess := &items.Session{}
+		var ip, ua, provider *string
+		err = rows.Scan(
+			&sess.Id,
+			&sess.Created,
+			&sess.LastUsed,
+			&sess.Expires,
+			&ip,
+			&ua,
+			&provider,
+			&sess.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sess.IP = deref(ip)
+		sess.UserAgent = deref(ua)
+		sess.Provider = deref(provider)
+		out = append(out, sess)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Revoke session of principal by access token id.
+func (m *TokenModule) RevokeSession(ctx context.Context, pid uint64, id uint64, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "tokens.revoke_session", nil)
+	defer span.End()
+	var family *uint64
+	err := tx.QueryRow(ctx, `
+	UPDATE access_tokens SET revoked = now(), revoke_reason = $3
+	WHERE id = $1 AND principal_id = $2 AND revoked IS NULL
+	RETURNING family
+	`, id, pid, REVOKE_SESSION).Scan(&family)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoSession
+		}
+		tracer.AddSpanError(span, err)
+		tracer.FailSpan(span, "query error")
+		return err
+	}
+	if family == nil {
+		return nil
+	}
+	return m.revokeFamily(ctx, *family, REVOKE_SESSION, tx)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
 	}
-	return id, nil
+	return s[:n]
 }
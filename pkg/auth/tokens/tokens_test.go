@@ -0,0 +1,32 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in       string
+		n        int
+		expected string
+	}{
+		{"short", 512, "short"},
+		{"abcdef", 3, "abc"},
+		{"aé", 2, "a"},
+		{"aé", 3, "aé"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+	}
+	for _, c := range cases {
+		if out := truncate(c.in, c.n); out != c.expected {
+			t.Errorf("truncate(%q, %v) = %q, expected %q", c.in, c.n, out, c.expected)
+		}
+	}
+	agent := strings.Repeat("a", 511) + "日本"
+	out := truncate(agent, 512)
+	if !utf8.ValidString(out) || len(out) != 511 {
+		t.Errorf("user agent cut to %v bytes, valid %v", len(out), utf8.ValidString(out))
+	}
+}
@@ -1,8 +1,67 @@
 package config
 
+import "time"
+
 type Config struct {
 	Listen 			int
 	AuthSecret      string
 	AuthExternalUrl string
 	AuthInternalUrl string
+
+	// Lifetime of an access token
+	AccessTokenTTL time.Duration
+	// Lifetime of a refresh token. Every refresh issues a new one,
+	// so the session slides while it is in use.
+	RefreshTokenTTL time.Duration
+	// Keys to hash stored tokens with. First one is used for new tokens,
+	// the rest are accepted until every token is rehashed.
+	TokenKeys []TokenKey
+	// PKCS#8 PEM keys to sign JWT access tokens with, current key first.
+	// Opaque access tokens are issued when empty.
+	JwtKeys   []JwtKey
+	JwtIssuer string
+	// Credentials of other CEC services allowed to introspect tokens,
+	// service name to secret
+	ServiceCredentials map[string]string
+
+	// Discord application credentials, used to refresh oauth tokens
+	DiscordClientId     string
+	DiscordClientSecret string
+	// How often to look for expiring discord tokens
+	DiscordRefreshInterval time.Duration
+	// How often to refetch discord profiles
+	DiscordResyncInterval time.Duration
+	// Guilds to track membership and roles in
+	DiscordGuilds []string
+	// Bot token to read guild members with. Without it the user's own
+	// token is used, which needs guilds.members.read scope.
+	DiscordBotToken string
+	// Hex encoded Ed25519 key of discord application, to verify interactions
+	DiscordPublicKey string
+
+	// Frontier application credentials, used to refresh oauth tokens
+	FrontierClientId     string
+	FrontierClientSecret string
+	// How often to look for expiring frontier tokens
+	FrontierRefreshInterval time.Duration
+	// How often to pull commander data from CAPI
+	FrontierSyncInterval time.Duration
+
+	// EDDN relay to consume faction data from, disabled when empty
+	EddnRelay string
+
+	// Discord webhook to post op reminders to, disabled when empty
+	OpsWebhook string
+	// How long before an op starts to remind members of it
+	OpsReminder time.Duration
+}
+
+type JwtKey struct {
+	Id   string
+	Path string
+}
+
+type TokenKey struct {
+	Id     string
+	Secret string
 }
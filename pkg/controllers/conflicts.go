@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api/httpapi"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/gin-gonic/gin"
+)
+
+func (ctrl *CoreController) ActiveConflicts(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.conflicts.active")
+	defer help.Span.End()
+	var factionId uint64
+	if raw := c.Query("faction_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			help.Error(http.StatusBadRequest, "invalid faction id")
+			return
+		}
+		factionId = id
+	}
+	conflicts, err := ctrl.Facade.ActiveConflicts(help.Ctx, factionId)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, conflicts)
+}
+
+func (ctrl *CoreController) FactionConflicts(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.conflicts")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	conflicts, err := ctrl.Facade.FactionConflicts(help.Ctx, id)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, conflicts)
+}
+
+func (ctrl *CoreController) SubmitConflicts(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.conflicts.submit")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	var req httpapi.ConflictsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	observations := make([]*factions.ConflictObservation, 0, len(req.Conflicts))
+	for _, r := range req.Conflicts {
+		observations = append(observations, &factions.ConflictObservation{
+			WarType:  r.WarType,
+			Status:   r.Status,
+			Faction1: conflictSide(&r.Faction1),
+			Faction2: conflictSide(&r.Faction2),
+		})
+	}
+	changed, err := ctrl.Facade.SubmitConflicts(help.Ctx, usr, req.System, req.Observed, observations)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changed": changed})
+}
+
+func (ctrl *CoreController) OverrideConflict(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.conflicts.override")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid conflict id")
+		return
+	}
+	var req httpapi.ConflictOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	conflict := &factions.Conflict{
+		Id:       id,
+		Status:   req.Status,
+		Faction1: conflictSide(&req.Faction1),
+		Faction2: conflictSide(&req.Faction2),
+		Outcome:  req.Outcome,
+		Manual:   req.Manual == nil || *req.Manual,
+	}
+	if err := ctrl.Facade.OverrideConflict(help.Ctx, admin, conflict); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, conflict)
+}
+
+func conflictSide(req *httpapi.ConflictSideRequest) factions.ConflictSide {
+	return factions.ConflictSide{
+		Name:    req.Name,
+		Stake:   req.Stake,
+		WonDays: req.WonDays,
+	}
+}
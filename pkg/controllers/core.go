@@ -2,15 +2,33 @@ package controllers
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Close-Encounters-Corps/cec-core/pkg/api/httpapi"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/facades"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/rules"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -45,9 +63,74 @@ func (help *RequestHelper) InternalError(err error) {
 	})
 }
 
+func (help *RequestHelper) Error(status int, message string) {
+	help.Req.JSON(status, httpapi.Error{
+		Message:   message,
+		RequestID: help.TraceID,
+	})
+}
+
+// Return X-Auth-Token of the request, responding with an error if it is missing.
+func (help *RequestHelper) Token() (string, bool) {
+	token := requestToken(help.Req)
+	if token == "" {
+		help.Error(http.StatusBadRequest, "token not provided")
+		return "", false
+	}
+	return token, true
+}
+
+func (help *RequestHelper) Client() *items.ClientInfo {
+	return &items.ClientInfo{
+		IP:        help.Req.ClientIP(),
+		UserAgent: help.Req.Request.UserAgent(),
+	}
+}
+
+// Respond with a status matching known domain errors.
+func (help *RequestHelper) DomainError(err error) {
+	switch {
+	case errors.Is(err, tokens.ErrInvalidToken):
+		help.Error(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, tokens.ErrScope):
+		help.Error(http.StatusForbidden, err.Error())
+	case errors.Is(err, tokens.ErrUnknownScope):
+		help.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, tokens.ErrNoSession), errors.Is(err, tokens.ErrApiKeyMissing):
+		help.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, facades.ErrAccountLinked), errors.Is(err, facades.ErrLastLoginMethod),
+		errors.Is(err, factions.ErrFactionExists), errors.Is(err, ops.ErrOpFull),
+		errors.Is(err, ops.ErrOpClosed):
+		help.Error(http.StatusConflict, err.Error())
+	case errors.Is(err, facades.ErrAmbiguous), errors.Is(err, rules.ErrInvalidRule),
+		errors.Is(err, journal.ErrNoCommander), errors.Is(err, journal.ErrCmdrRequired),
+		errors.Is(err, factions.ErrInvalidFaction), errors.Is(err, factions.ErrNotSupported),
+		errors.Is(err, factions.ErrInvalidConflict), errors.Is(err, ops.ErrInvalidOp),
+		errors.Is(err, users.ErrSelfMerge):
+		help.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, journal.ErrBatchTooLarge):
+		help.Error(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, discord.ErrAccountNotFound), errors.Is(err, pgx.ErrNoRows):
+		help.Error(http.StatusNotFound, "not found")
+	case errors.Is(err, facades.ErrForbidden):
+		help.Error(http.StatusForbidden, err.Error())
+	default:
+		help.InternalError(err)
+	}
+}
 
 func (ctrl *CoreController) LoginDiscord(c *gin.Context) {
-	help := NewRequestHelper(c, "/login/discord")
+	ctrl.login(c, "discord")
+}
+
+func (ctrl *CoreController) LoginFrontier(c *gin.Context) {
+	ctrl.login(c, "frontier")
+}
+
+// Two-phase login through cec-auth: without state respond with
+// oauth url of provider, with state exchange it for a token.
+func (ctrl *CoreController) login(c *gin.Context, kind string) {
+	help := NewRequestHelper(c, "/login/"+kind)
 	defer help.Span.End()
 	internalError := func(err error) {
 		help.InternalError(err)
@@ -60,7 +143,7 @@ func (ctrl *CoreController) LoginDiscord(c *gin.Context) {
 			internalError(err)
 			return
 		}
-		u, err = u.Parse("/oauth/discord")
+		u, err = u.Parse("/oauth/" + kind)
 		if err != nil {
 			internalError(err)
 			return
@@ -76,7 +159,11 @@ func (ctrl *CoreController) LoginDiscord(c *gin.Context) {
 		return
 	}
 	tracer.AddSpanTags(help.Span, map[string]string{"state": state})
-	token, err := ctrl.Facade.Authenticate(help.Ctx, "discord", state)
+	if grant, ok := c.Get(GRANT_KEY); ok && grant.(*tokens.Grant).ApiKeyId != 0 {
+		help.Error(http.StatusForbidden, "api keys cannot link accounts")
+		return
+	}
+	token, err := ctrl.Facade.Authenticate(help.Ctx, kind, state, help.Client())
 	if err != nil {
 		if err.Error() == "state not found" {
 			c.JSON(http.StatusBadRequest, httpapi.Error{
@@ -85,33 +172,56 @@ func (ctrl *CoreController) LoginDiscord(c *gin.Context) {
 			})
 			return
 		}
-		internalError(err)
+		help.DomainError(err)
 		return
 	}
 	result := httpapi.AuthPhaseResult{
 		Phase: 2,
-		Token: token,
+	}
+	if token != nil {
+		result.Token = token.AccessToken
+		result.RefreshToken = token.RefreshToken
+		result.Expires = token.Expires
 	}
 	c.JSON(http.StatusOK, result)
 }
 
 
-func (ctrl *CoreController) CurrentUser(c *gin.Context) {
-	help := NewRequestHelper(c, "controller.users.current")
+func (ctrl *CoreController) RefreshToken(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.tokens.refresh")
 	defer help.Span.End()
-	token := c.Request.Header.Get("X-Auth-Token")
-	if token == "" {
+	var req httpapi.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, httpapi.Error{
-			Message:   "token not provided",
+			Message:   "refresh token not provided",
 			RequestID: help.TraceID,
 		})
 		return
 	}
-	user, err := ctrl.Facade.CurrentUser(help.Ctx, token)
+	pair, err := ctrl.Facade.RefreshToken(help.Ctx, req.RefreshToken, help.Client())
 	if err != nil {
+		if errors.Is(err, tokens.ErrInvalidToken) || errors.Is(err, tokens.ErrTokenReused) {
+			c.JSON(http.StatusUnauthorized, httpapi.Error{
+				Message:   err.Error(),
+				RequestID: help.TraceID,
+			})
+			return
+		}
 		help.InternalError(err)
 		return
 	}
+	c.JSON(http.StatusOK, pair)
+}
+
+func (ctrl *CoreController) CurrentUser(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.users.current")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	user, err := ctrl.Facade.CurrentUser(help.Ctx, usr)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
 
@@ -132,4 +242,292 @@ func (ctrl *CoreController) PromoteToAdmin(c *gin.Context) {
 		return
 	}
 	c.Status(http.StatusOK)
-}
\ No newline at end of file
+}
+
+func (ctrl *CoreController) Logout(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.logout")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	if err := ctrl.Facade.Logout(help.Ctx, token); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) LogoutAll(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.logout.all")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	if err := ctrl.Facade.LogoutAll(help.Ctx, token); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) RevokePrincipalTokens(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.principals.tokens.revoke")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	pid, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid principal id")
+		return
+	}
+	if err := ctrl.Facade.RevokePrincipalTokens(help.Ctx, token, pid); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) Sessions(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.users.current.sessions")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	sessions, err := ctrl.Facade.Sessions(help.Ctx, token)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (ctrl *CoreController) KillSession(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.users.current.sessions.delete")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid session id")
+		return
+	}
+	if err := ctrl.Facade.KillSession(help.Ctx, token, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) ApiKeys(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.apikeys")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	keys, err := ctrl.Facade.ApiKeys(help.Ctx, token)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (ctrl *CoreController) CreateApiKey(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.apikeys.create")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	var req httpapi.ApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	key, err := ctrl.Facade.CreateApiKey(help.Ctx, token, req.Name, req.Scopes, req.Expires)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func (ctrl *CoreController) RevokeApiKey(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.apikeys.delete")
+	defer help.Span.End()
+	token, ok := help.Token()
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid api key id")
+		return
+	}
+	if err := ctrl.Facade.RevokeApiKey(help.Ctx, token, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) Jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ctrl.Facade.Jwks())
+}
+
+// Check HTTP basic credentials of a CEC service.
+func (ctrl *CoreController) serviceAuthorized(c *gin.Context) bool {
+	name, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, found := ctrl.Config.ServiceCredentials[name]
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+func (ctrl *CoreController) Introspect(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.oauth.introspect")
+	defer help.Span.End()
+	if !ctrl.serviceAuthorized(c) {
+		c.Header("WWW-Authenticate", `Basic realm="cec-core"`)
+		help.Error(http.StatusUnauthorized, "invalid service credentials")
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		help.Error(http.StatusBadRequest, "token not provided")
+		return
+	}
+	grant, user, err := ctrl.Facade.Introspect(help.Ctx, token)
+	if err != nil {
+		help.InternalError(err)
+		return
+	}
+	if grant == nil {
+		c.JSON(http.StatusOK, httpapi.IntrospectionResult{Active: false})
+		return
+	}
+	result := httpapi.IntrospectionResult{
+		Active:      true,
+		Scope:       strings.Join(grant.Granted(), " "),
+		TokenType:   "access_token",
+		Sub:         fmt.Sprint(grant.PrincipalId),
+		PrincipalId: grant.PrincipalId,
+		UserId:      user.Id,
+		Admin:       user.Principal.Admin,
+		State:       user.Principal.State,
+	}
+	if grant.ApiKeyId != 0 {
+		result.TokenType = "api_key"
+	}
+	if grant.Expires != nil {
+		result.Exp = grant.Expires.Unix()
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (ctrl *CoreController) UnlinkDiscord(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.users.current.discord.delete")
+	defer help.Span.End()
+	user, _ := auth.FromContext(help.Ctx)
+	var id uint64
+	if raw := c.Query("id"); raw != "" {
+		var err error
+		id, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			help.Error(http.StatusBadRequest, "invalid account id")
+			return
+		}
+	}
+	if err := ctrl.Facade.UnlinkDiscord(help.Ctx, user, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) MergeUsers(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.users.merge")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	target, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req httpapi.MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	user, err := ctrl.Facade.MergeUsers(help.Ctx, admin, target, req.SourceUserId)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// Discord interactions webhook. Requests not signed with
+// the application key are rejected, as discord requires.
+func (ctrl *CoreController) DiscordInteractions(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.discord.interactions")
+	defer help.Span.End()
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	ok := discord.VerifyInteraction(
+		ctrl.Config.DiscordPublicKey,
+		c.GetHeader("X-Signature-Ed25519"),
+		c.GetHeader("X-Signature-Timestamp"),
+		body,
+		time.Now(),
+	)
+	if !ok {
+		help.Error(http.StatusUnauthorized, "invalid request signature")
+		return
+	}
+	var in discord.Interaction
+	if err := json.Unmarshal(body, &in); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := ctrl.Facade.Interact(help.Ctx, &in)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Upload batch of journal lines. Only API keys with journal:write
+// scope are accepted, so uploaders never hold a login token.
+func (ctrl *CoreController) UploadJournal(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.journal.upload")
+	defer help.Span.End()
+	if grant, ok := c.Get(GRANT_KEY); !ok || grant.(*tokens.Grant).ApiKeyId == 0 {
+		help.Error(http.StatusForbidden, "journal upload requires an api key")
+		return
+	}
+	usr, _ := auth.FromContext(help.Ctx)
+	result, err := ctrl.Facade.IngestJournal(help.Ctx, usr, c.Query("cmdr"), c.Request.Body)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
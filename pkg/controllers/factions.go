@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api/httpapi"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/gin-gonic/gin"
+)
+
+func (ctrl *CoreController) Factions(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.list")
+	defer help.Span.End()
+	filter := &factions.Filter{
+		Query:      c.Query("q"),
+		Allegiance: c.Query("allegiance"),
+	}
+	if raw := c.Query("supported"); raw != "" {
+		supported, err := strconv.ParseBool(raw)
+		if err != nil {
+			help.Error(http.StatusBadRequest, "invalid supported flag")
+			return
+		}
+		filter.Supported = &supported
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			help.Error(http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			help.Error(http.StatusBadRequest, "invalid offset")
+			return
+		}
+		filter.Offset = offset
+	}
+	out, err := ctrl.Facade.Factions(help.Ctx, filter)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (ctrl *CoreController) Faction(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.get")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	faction, err := ctrl.Facade.Faction(help.Ctx, id)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, faction)
+}
+
+func (ctrl *CoreController) CreateFaction(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.create")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	var req httpapi.FactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	faction := gameFaction(&req)
+	if err := ctrl.Facade.CreateFaction(help.Ctx, admin, faction); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusCreated, faction)
+}
+
+func (ctrl *CoreController) UpdateFaction(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.update")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	var req httpapi.FactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	faction := gameFaction(&req)
+	faction.Id = id
+	if err := ctrl.Facade.UpdateFaction(help.Ctx, admin, faction); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, faction)
+}
+
+func (ctrl *CoreController) DeleteFaction(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.delete")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	if err := ctrl.Facade.DeleteFaction(help.Ctx, admin, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) IngestInfluence(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.influence.ingest")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	var req []*httpapi.InfluenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	snapshots := make([]*factions.InfluenceSnapshot, 0, len(req))
+	for _, r := range req {
+		snapshots = append(snapshots, &factions.InfluenceSnapshot{
+			System:           r.System,
+			Tick:             r.Tick,
+			Influence:        r.Influence,
+			Happiness:        r.Happiness,
+			ActiveStates:     r.ActiveStates,
+			PendingStates:    r.PendingStates,
+			RecoveringStates: r.RecoveringStates,
+		})
+	}
+	if err := ctrl.Facade.IngestInfluence(help.Ctx, usr, id, snapshots); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+func (ctrl *CoreController) InfluenceHistory(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.influence.history")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		if days, err = strconv.Atoi(raw); err != nil || days <= 0 {
+			help.Error(http.StatusBadRequest, "invalid days")
+			return
+		}
+	}
+	history, err := ctrl.Facade.InfluenceHistory(help.Ctx, id, c.Query("system"), days)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (ctrl *CoreController) InfluenceDrops(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.influence.drops")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	threshold := factions.DEFAULT_DROP
+	if raw := c.Query("threshold"); raw != "" {
+		if threshold, err = strconv.ParseFloat(raw, 64); err != nil || threshold < 0 || threshold > 1 {
+			help.Error(http.StatusBadRequest, "invalid threshold")
+			return
+		}
+	}
+	drops, err := ctrl.Facade.InfluenceDrops(help.Ctx, id, threshold)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, drops)
+}
+
+func (ctrl *CoreController) Ticks(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ticks.list")
+	defer help.Span.End()
+	limit := 30
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > factions.MAX_LIMIT {
+			help.Error(http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	ticks, err := ctrl.Facade.Ticks(help.Ctx, limit)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, ticks)
+}
+
+// Report is rendered as Markdown with ?format=markdown
+// or when Accept prefers text/markdown.
+func (ctrl *CoreController) FactionReport(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.factions.report")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid faction id")
+		return
+	}
+	var tickId uint64
+	if raw := c.Param("tick"); raw != "latest" {
+		if tickId, err = strconv.ParseUint(raw, 10, 64); err != nil || tickId == 0 {
+			help.Error(http.StatusBadRequest, "invalid tick id")
+			return
+		}
+	}
+	format := c.Query("format")
+	if format == "" && c.NegotiateFormat(gin.MIMEJSON, "text/markdown") == "text/markdown" {
+		format = "markdown"
+	}
+	if format != "" && format != "json" && format != "markdown" {
+		help.Error(http.StatusBadRequest, "format must be json or markdown")
+		return
+	}
+	report, err := ctrl.Facade.FactionReport(help.Ctx, id, tickId)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	if format == "markdown" {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report.Markdown()))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func gameFaction(req *httpapi.FactionRequest) *factions.GameFaction {
+	return &factions.GameFaction{
+		Name:              req.Name,
+		Allegiance:        req.Allegiance,
+		Government:        req.Government,
+		HomeSystem:        req.HomeSystem,
+		SquadronSupported: req.SquadronSupported,
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// Key of *tokens.Grant in gin context
+const GRANT_KEY = "cec.grant"
+
+// Key of scope checked by RequireScope in gin context
+const SCOPE_KEY = "cec.scope"
+
+// Token from X-Auth-Token or Authorization: Bearer header.
+func requestToken(c *gin.Context) string {
+	if token := c.GetHeader("X-Auth-Token"); token != "" {
+		return token
+	}
+	header := c.GetHeader("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// Resolve request token into a user and put it into request context
+// with auth.NewContext. Requests without a valid token pass through
+// anonymous, so expired tokens do not break refresh and login;
+// use guards to reject them.
+func (ctrl *CoreController) Authentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := requestToken(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+		help := NewRequestHelper(c, "middleware.authentication")
+		grant, user, err := ctrl.Facade.Resolve(help.Ctx, token)
+		help.Span.End()
+		if errors.Is(err, tokens.ErrInvalidToken) {
+			c.Next()
+			return
+		}
+		if err != nil {
+			help.InternalError(err)
+			c.Abort()
+			return
+		}
+		c.Set(GRANT_KEY, grant)
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), user))
+		c.Next()
+	}
+}
+
+func abort(c *gin.Context, status int, message string) {
+	help := NewRequestHelper(c, "middleware.guard")
+	defer help.Span.End()
+	help.Error(status, message)
+	c.Abort()
+}
+
+// API keys pass guards only on routes which declare a scope with
+// RequireScope before the guard, login tokens always pass.
+func keyAllowed(c *gin.Context) bool {
+	value, ok := c.Get(GRANT_KEY)
+	if !ok || value.(*tokens.Grant).ApiKeyId == 0 {
+		return true
+	}
+	_, scoped := c.Get(SCOPE_KEY)
+	return scoped
+}
+
+// Reject anonymous requests.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := auth.FromContext(c.Request.Context()); !ok {
+			abort(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !keyAllowed(c) {
+			abort(c, http.StatusForbidden, tokens.ErrScope.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// Reject requests of non-admins.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			abort(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !keyAllowed(c) {
+			abort(c, http.StatusForbidden, tokens.ErrScope.Error())
+			return
+		}
+		if !user.Principal.Admin {
+			abort(c, http.StatusForbidden, "admin required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Reject requests of principals not in state.
+func RequireState(state string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			abort(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !keyAllowed(c) {
+			abort(c, http.StatusForbidden, tokens.ErrScope.Error())
+			return
+		}
+		if user.Principal.State != state {
+			abort(c, http.StatusForbidden, "principal is "+user.Principal.State)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Reject API keys lacking scope. Login tokens have every scope.
+// Put it before other guards of the route, they reject API keys otherwise.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(GRANT_KEY)
+		if !ok {
+			abort(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !value.(*tokens.Grant).Allows(scope) {
+			abort(c, http.StatusForbidden, tokens.ErrScope.Error())
+			return
+		}
+		c.Set(SCOPE_KEY, scope)
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	admin       = &items.User{Id: 1, Principal: &items.Principal{Id: 1, Admin: true, State: items.StateApproved}}
+	member      = &items.User{Id: 2, Principal: &items.Principal{Id: 2, State: items.StatePending}}
+	loginGrant  = &tokens.Grant{PrincipalId: 1}
+	factionsKey = &tokens.Grant{PrincipalId: 1, ApiKeyId: 7, Scopes: []string{tokens.SCOPE_FACTIONS_WRITE}}
+	usersKey    = &tokens.Grant{PrincipalId: 2, ApiKeyId: 8, Scopes: []string{tokens.SCOPE_USERS_READ}}
+)
+
+// Stand-in for Authentication, puts grant and usr into request.
+func authenticate(grant *tokens.Grant, usr *items.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if grant != nil {
+			c.Set(GRANT_KEY, grant)
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), usr))
+		}
+		c.Next()
+	}
+}
+
+func TestGuards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name   string
+		grant  *tokens.Grant
+		usr    *items.User
+		guards []gin.HandlerFunc
+		status int
+	}{
+		{"anonymous", nil, nil, []gin.HandlerFunc{RequireAuth()}, http.StatusUnauthorized},
+		{"anonymous scope", nil, nil, []gin.HandlerFunc{RequireScope(tokens.SCOPE_FACTIONS_WRITE)}, http.StatusUnauthorized},
+		{"login auth", loginGrant, admin, []gin.HandlerFunc{RequireAuth()}, http.StatusOK},
+		{"login admin", loginGrant, admin, []gin.HandlerFunc{RequireAdmin()}, http.StatusOK},
+		{"login scoped admin", loginGrant, admin, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_WRITE), RequireAdmin()}, http.StatusOK},
+		{"non-admin", loginGrant, member, []gin.HandlerFunc{RequireAdmin()}, http.StatusForbidden},
+		{"wrong state", loginGrant, member, []gin.HandlerFunc{RequireState(items.StateApproved)}, http.StatusForbidden},
+		{"key unscoped auth", factionsKey, admin, []gin.HandlerFunc{RequireAuth()}, http.StatusForbidden},
+		{"key unscoped admin", factionsKey, admin, []gin.HandlerFunc{RequireAdmin()}, http.StatusForbidden},
+		{"key unscoped state", factionsKey, admin, []gin.HandlerFunc{RequireState(items.StateApproved)}, http.StatusForbidden},
+		{"key other scope", factionsKey, admin, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_WRITE), RequireAdmin()}, http.StatusForbidden},
+		{"key scoped admin", factionsKey, admin, []gin.HandlerFunc{RequireScope(tokens.SCOPE_FACTIONS_WRITE), RequireAdmin()}, http.StatusOK},
+		{"key scoped non-admin", factionsKey, member, []gin.HandlerFunc{RequireScope(tokens.SCOPE_FACTIONS_WRITE), RequireAdmin()}, http.StatusForbidden},
+		{"anonymous current user", nil, nil, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_READ), RequireAuth()}, http.StatusUnauthorized},
+		{"login current user", loginGrant, member, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_READ), RequireAuth()}, http.StatusOK},
+		{"key current user", usersKey, member, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_READ), RequireAuth()}, http.StatusOK},
+		{"key current user other scope", factionsKey, member, []gin.HandlerFunc{RequireScope(tokens.SCOPE_USERS_READ), RequireAuth()}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		handlers := append([]gin.HandlerFunc{authenticate(tc.grant, tc.usr)}, tc.guards...)
+		handlers = append(handlers, func(c *gin.Context) { c.Status(http.StatusOK) })
+		r.POST("/", handlers...)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api/httpapi"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
+	"github.com/gin-gonic/gin"
+)
+
+func (ctrl *CoreController) Ops(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.list")
+	defer help.Span.End()
+	// ops which are not over yet by default
+	from := time.Now()
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			help.Error(http.StatusBadRequest, "invalid from")
+			return
+		}
+		from = parsed
+	}
+	filter := &ops.Filter{
+		Status: c.Query("status"),
+		From:   &from,
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			help.Error(http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			help.Error(http.StatusBadRequest, "invalid offset")
+			return
+		}
+		filter.Offset = offset
+	}
+	found, err := ctrl.Facade.Ops(help.Ctx, filter)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, found)
+}
+
+func (ctrl *CoreController) Op(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.get")
+	defer help.Span.End()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	op, err := ctrl.Facade.Op(help.Ctx, id)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+func (ctrl *CoreController) UserOps(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.current")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	found, err := ctrl.Facade.UserOps(help.Ctx, usr)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, found)
+}
+
+func (ctrl *CoreController) CreateOp(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.create")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	var req httpapi.OpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	op := squadronOp(&req)
+	if err := ctrl.Facade.CreateOp(help.Ctx, admin, op); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusCreated, op)
+}
+
+func (ctrl *CoreController) UpdateOp(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.update")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	var req httpapi.OpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	op := squadronOp(&req)
+	op.Id = id
+	if err := ctrl.Facade.UpdateOp(help.Ctx, admin, op); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+func (ctrl *CoreController) CancelOp(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.cancel")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	if err := ctrl.Facade.CancelOp(help.Ctx, admin, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) SignUp(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.signup")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	if err := ctrl.Facade.SignUp(help.Ctx, usr, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) Withdraw(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.withdraw")
+	defer help.Span.End()
+	usr, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	if err := ctrl.Facade.Withdraw(help.Ctx, usr, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) CompleteOp(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.ops.complete")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid op id")
+		return
+	}
+	var req httpapi.OpReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	report := &ops.Report{
+		Outcome: req.Outcome,
+		Summary: req.Summary,
+	}
+	if err := ctrl.Facade.CompleteOp(help.Ctx, admin, id, report, req.Attended); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func squadronOp(req *httpapi.OpRequest) *ops.Op {
+	return &ops.Op{
+		Title:     req.Title,
+		Kind:      req.Kind,
+		FactionId: req.FactionId,
+		System:    req.System,
+		Objective: req.Objective,
+		Starts:    req.Starts,
+		Ends:      req.Ends,
+		Capacity:  req.Capacity,
+	}
+}
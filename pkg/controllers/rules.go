@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api/httpapi"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/gin-gonic/gin"
+)
+
+func (ctrl *CoreController) RoleRules(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.rules.list")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	rules, err := ctrl.Facade.RoleRules(help.Ctx, admin)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (ctrl *CoreController) CreateRoleRule(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.rules.create")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	var req httpapi.RoleRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		help.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	rule := roleRule(&req)
+	if err := ctrl.Facade.CreateRoleRule(help.Ctx, admin, rule); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (ctrl *CoreController) DeleteRoleRule(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.rules.delete")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid rule id")
+		return
+	}
+	if err := ctrl.Facade.DeleteRoleRule(help.Ctx, admin, id); err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *CoreController) DryRunRoleRules(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.rules.dryrun")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	var req httpapi.DryRunRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			help.Error(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var candidates []*items.RoleRule
+	if req.Rules != nil {
+		candidates = make([]*items.RoleRule, 0, len(req.Rules))
+		for _, r := range req.Rules {
+			candidates = append(candidates, roleRule(r))
+		}
+	}
+	changes, err := ctrl.Facade.DryRunRoleRules(help.Ctx, admin, candidates)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+func (ctrl *CoreController) PrincipalAudit(c *gin.Context) {
+	help := NewRequestHelper(c, "controller.principals.audit")
+	defer help.Span.End()
+	admin, _ := auth.FromContext(help.Ctx)
+	pid, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		help.Error(http.StatusBadRequest, "invalid principal id")
+		return
+	}
+	changes, err := ctrl.Facade.PrincipalAudit(help.Ctx, admin, pid)
+	if err != nil {
+		help.DomainError(err)
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+func roleRule(req *httpapi.RoleRuleRequest) *items.RoleRule {
+	return &items.RoleRule{
+		GuildId:  req.GuildId,
+		RoleId:   req.RoleId,
+		Absent:   req.Absent,
+		Effect:   req.Effect,
+		State:    req.State,
+		Priority: req.Priority,
+	}
+}
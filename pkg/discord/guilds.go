@@ -0,0 +1,158 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+)
+
+type guildMemberResponse struct {
+	Nick     *string    `json:"nick"`
+	Roles    []string   `json:"roles"`
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+// Request membership of account in every tracked guild. Guilds the
+// account is not a member of are left out.
+func (m *DiscordModule) FetchGuilds(ctx context.Context, acc *items.DiscordAccount) ([]*items.DiscordGuildMember, error) {
+	ctx, span := tracer.NewSpan(ctx, "discord.fetch_guilds", nil)
+	defer span.End()
+	out := make([]*items.DiscordGuildMember, 0)
+	for _, guild := range m.config.DiscordGuilds {
+		member, err := m.fetchGuildMember(ctx, acc, guild)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "guild fetch error")
+			return nil, err
+		}
+		if member != nil {
+			out = append(out, member)
+		}
+	}
+	return out, nil
+}
+
+func (m *DiscordModule) fetchGuildMember(ctx context.Context, acc *items.DiscordAccount, guild string) (*items.DiscordGuildMember, error) {
+	var (
+		url           string
+		authorization string
+	)
+	if m.config.DiscordBotToken != "" {
+		url = fmt.Sprintf("%s/guilds/%s/members/%s", API_URL, guild, acc.DiscordId)
+		authorization = "Bot " + m.config.DiscordBotToken
+	} else {
+		url = fmt.Sprintf("%s/users/@me/guilds/%s/member", API_URL, guild)
+		authorization = fmt.Sprintf("%v %v", acc.TokenType, acc.AccessToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // not a member -- not an error!
+	}
+	if resp.StatusCode == http.StatusUnauthorized && m.config.DiscordBotToken == "" {
+		return nil, ErrReauthRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discord guild member request failed: %v", resp.StatusCode)
+	}
+	var body guildMemberResponse
+	if err = json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	member := &items.DiscordGuildMember{
+		AccountId: acc.Id,
+		GuildId:   guild,
+		Roles:     body.Roles,
+		JoinedAt:  body.JoinedAt,
+		Synced:    &now,
+	}
+	if member.Roles == nil {
+		member.Roles = []string{}
+	}
+	if body.Nick != nil {
+		member.Nick = *body.Nick
+	}
+	return member, nil
+}
+
+// Replace stored guild memberships of account.
+func (m *DiscordModule) SaveGuilds(ctx context.Context, accountId uint64, members []*items.DiscordGuildMember, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+	DELETE FROM discord_guild_members WHERE account_id = $1
+	`, accountId)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO discord_guild_members (
+			account_id, guild_id, roles, nick, joined_at, synced
+		) VALUES ($1, $2, $3, NULLIF($4, ''), $5, now())
+		`, accountId, member.GuildId, member.Roles, member.Nick, member.JoinedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch and store guild memberships of account.
+func (m *DiscordModule) SyncGuilds(ctx context.Context, acc *items.DiscordAccount, tx pgx.Tx) error {
+	if len(m.config.DiscordGuilds) == 0 {
+		return nil
+	}
+	members, err := m.FetchGuilds(ctx, acc)
+	if err != nil {
+		return err
+	}
+	return m.SaveGuilds(ctx, acc.Id, members, tx)
+}
+
+// Guild memberships of every discord account linked to user.
+func (m *DiscordModule) FindGuilds(ctx context.Context, userId uint64, db api.DbConn) ([]*items.DiscordGuildMember, error) {
+	out := make([]*items.DiscordGuildMember, 0)
+	rows, err := db.Query(ctx, `
+	SELECT gm.account_id, gm.guild_id, gm.roles, COALESCE(gm.nick, ''), gm.joined_at, gm.synced
+	FROM discord_guild_members gm
+	JOIN discord_accounts dis ON dis.id = gm.account_id
+	WHERE dis.user_id = $1
+	ORDER BY gm.account_id, gm.guild_id
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gm := &items.DiscordGuildMember{}
+		err = rows.Scan(&gm.AccountId, &gm.GuildId, &gm.Roles, &gm.Nick, &gm.JoinedAt, &gm.Synced)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Interaction types sent by discord
+const (
+	INTERACTION_PING    = 1
+	INTERACTION_COMMAND = 2
+)
+
+// Interaction response types
+const (
+	RESPONSE_PONG    = 1
+	RESPONSE_MESSAGE = 4
+)
+
+// Message flag making response visible only to the invoker
+const FLAG_EPHEMERAL = 1 << 6
+
+// Command option holding a user mention
+const OPTION_USER = 6
+
+// Interactions signed earlier than that are rejected as replayed
+const INTERACTION_MAX_AGE = 5 * time.Minute
+
+type InteractionUser struct {
+	Id            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+}
+
+type InteractionMember struct {
+	User  *InteractionUser `json:"user"`
+	Roles []string         `json:"roles"`
+}
+
+type InteractionOption struct {
+	Name  string      `json:"name"`
+	Type  int         `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type InteractionData struct {
+	Name     string               `json:"name"`
+	Options  []*InteractionOption `json:"options"`
+	Resolved struct {
+		Users map[string]*InteractionUser `json:"users"`
+	} `json:"resolved"`
+}
+
+// Incoming interaction webhook payload
+type Interaction struct {
+	Id      string             `json:"id"`
+	Type    int                `json:"type"`
+	GuildId string             `json:"guild_id,omitempty"`
+	Data    *InteractionData   `json:"data,omitempty"`
+	Member  *InteractionMember `json:"member,omitempty"`
+	User    *InteractionUser   `json:"user,omitempty"`
+}
+
+// User who invoked the interaction, in a guild or in DM.
+func (i *Interaction) Invoker() *InteractionUser {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// Snowflake of user passed in option name, empty if missing.
+func (i *Interaction) UserOption(name string) string {
+	if i.Data == nil {
+		return ""
+	}
+	for _, opt := range i.Data.Options {
+		if opt.Name == name && opt.Type == OPTION_USER {
+			if id, ok := opt.Value.(string); ok {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+type InteractionMessage struct {
+	Content string `json:"content"`
+	Flags   int    `json:"flags,omitempty"`
+}
+
+type InteractionResponse struct {
+	Type int                 `json:"type"`
+	Data *InteractionMessage `json:"data,omitempty"`
+}
+
+// Ephemeral text reply to a command.
+func Reply(content string) *InteractionResponse {
+	return &InteractionResponse{
+		Type: RESPONSE_MESSAGE,
+		Data: &InteractionMessage{
+			Content: content,
+			Flags:   FLAG_EPHEMERAL,
+		},
+	}
+}
+
+// Check Ed25519 signature of interaction request. Discord signs
+// timestamp header followed by raw body with the application key.
+func VerifyInteraction(publicKey string, signature string, timestamp string, body []byte, now time.Time) bool {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > INTERACTION_MAX_AGE || age < -INTERACTION_MAX_AGE {
+		return false
+	}
+	msg := make([]byte, 0, len(timestamp)+len(body))
+	msg = append(msg, timestamp...)
+	msg = append(msg, body...)
+	return ed25519.Verify(ed25519.PublicKey(key), msg, sig)
+}
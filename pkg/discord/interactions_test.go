@@ -0,0 +1,70 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signInteraction(t *testing.T, key ed25519.PrivateKey, ts time.Time, body []byte) (string, string) {
+	t.Helper()
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	sig := ed25519.Sign(key, append([]byte(timestamp), body...))
+	return hex.EncodeToString(sig), timestamp
+}
+
+func TestVerifyInteraction(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := hex.EncodeToString(pub)
+	body := []byte(`{"type": 1}`)
+	now := time.Now()
+	sig, ts := signInteraction(t, key, now, body)
+	if !VerifyInteraction(publicKey, sig, ts, body, now) {
+		t.Error("valid signature rejected")
+	}
+	if VerifyInteraction(publicKey, sig, ts, []byte(`{"type": 2}`), now) {
+		t.Error("tampered body accepted")
+	}
+	if VerifyInteraction(publicKey, sig, ts, body, now.Add(time.Hour)) {
+		t.Error("stale timestamp accepted")
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	sig, ts = signInteraction(t, other, now, body)
+	if VerifyInteraction(publicKey, sig, ts, body, now) {
+		t.Error("foreign signature accepted")
+	}
+	if VerifyInteraction("", sig, ts, body, now) {
+		t.Error("signature accepted without key")
+	}
+}
+
+func TestInteractionOptions(t *testing.T) {
+	var in Interaction
+	err := json.Unmarshal([]byte(`{
+		"id": "2",
+		"type": 2,
+		"guild_id": "100",
+		"member": {"user": {"id": "42", "username": "cmdr"}, "roles": []},
+		"data": {
+			"name": "whois",
+			"options": [{"name": "user", "type": 6, "value": "43"}],
+			"resolved": {"users": {"43": {"id": "43", "username": "other"}}}
+		}
+	}`), &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Invoker().Id != "42" {
+		t.Errorf("unexpected invoker %+v", in.Invoker())
+	}
+	if in.UserOption("user") != "43" || in.UserOption("role") != "" {
+		t.Error("unexpected user option")
+	}
+}
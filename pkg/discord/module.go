@@ -1,48 +1,76 @@
 package discord
 
-// TODO https://discord.com/developers/docs/topics/oauth2#authorization-code-grant-refresh-token-exchange-example
-
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var MODULE_NAME = "discord"
 
-func NewDiscordModule(api ApiClient) *DiscordModule {
+var ErrAccountNotFound = errors.New("discord account not found")
+
+const API_URL = "https://discord.com/api"
+
+func NewDiscordModule(api ApiClient, db *pgxpool.Pool, cfg *config.Config) *DiscordModule {
 	if api == nil {
 		api = &http.Client{
 			Timeout: 10 * time.Second,
 		}
 	}
-	return &DiscordModule{
+	m := &DiscordModule{
 		client: api,
+		db:     db,
+		config: cfg,
 	}
+	m.refresher = auth.NewTokenRefresher(MODULE_NAME, "discord_accounts", m.RefreshToken, ErrReauthRequired, db)
+	return m
 }
 
 type ApiClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// Called with owner of account after it is resynced, in the same transaction
+type SyncHook func(ctx context.Context, userId uint64, tx pgx.Tx) error
+
 type DiscordModule struct {
-	client ApiClient
+	client    ApiClient
+	db        *pgxpool.Pool
+	config    *config.Config
+	refresher *auth.TokenRefresher
+	hooks     []SyncHook
+}
+
+// Register hook to run after every resync.
+func (m *DiscordModule) OnSync(hook SyncHook) {
+	m.hooks = append(m.hooks, hook)
 }
 
 func (m *DiscordModule) Start(ctx context.Context) error {
+	if m.db != nil && m.config.DiscordClientId != "" && m.config.DiscordRefreshInterval > 0 {
+		go m.refresher.Loop(ctx, m.config.DiscordRefreshInterval)
+	}
+	if m.db != nil && m.config.DiscordResyncInterval > 0 {
+		go m.resyncLoop(ctx)
+	}
 	return nil
 }
 
 // Request user information using oauth token info
 func (m *DiscordModule) FetchApi(ctx context.Context, token *auth.OauthToken) (*items.DiscordAccount, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://discord.com/api/users/@me", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", API_URL+"/users/@me", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -56,15 +84,24 @@ func (m *DiscordModule) FetchApi(ctx context.Context, token *auth.OauthToken) (*
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrReauthRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discord api request failed: %v", resp.StatusCode)
+	}
 	var disUser items.DiscordApiUser
 	err = json.Unmarshal(raw, &disUser)
 	if err != nil {
 		return nil, err
 	}
-	username := fmt.Sprintf("%s#%s", disUser.Username, disUser.Discriminator)
+	if disUser.Id == "" {
+		return nil, fmt.Errorf("discord user has no id")
+	}
 	now := time.Now()
 	acc := items.DiscordAccount{
-		Username:    username,
+		DiscordId:   disUser.Id,
+		Username:    DisplayName(&disUser),
 		ApiResponse: disUser,
 		Created:     &now,
 		Updated:     &now,
@@ -83,6 +120,7 @@ func (m *DiscordModule) NewAccount(ctx context.Context, account *items.DiscordAc
 	err := tx.QueryRow(ctx, `
 	INSERT INTO discord_accounts (
 		user_id,
+		discord_id,
 		username,
 		api_response,
 		created,
@@ -91,16 +129,26 @@ func (m *DiscordModule) NewAccount(ctx context.Context, account *items.DiscordAc
 		token_type,
 		token_expires_in,
 		refresh_token
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	RETURNING id
-	`, userId, account.Username, account.ApiResponse,
+	`, userId, account.DiscordId, account.Username, account.ApiResponse,
 		account.Created, account.Updated, account.AccessToken,
 		account.TokenType, account.TokenExpiresIn, account.RefreshToken,
 	).Scan(&id)
 	return id, err
 }
 
-func (m *DiscordModule) FindUser(ctx context.Context, username string, tx pgx.Tx) (*items.User, error) {
+// Username for display: pomelo usernames are unique by themselves,
+// legacy ones need the discriminator.
+func DisplayName(u *items.DiscordApiUser) string {
+	if u.Discriminator == "" || u.Discriminator == "0" {
+		return u.Username
+	}
+	return fmt.Sprintf("%s#%s", u.Username, u.Discriminator)
+}
+
+// Find user owning discord account by its snowflake id.
+func (m *DiscordModule) FindUser(ctx context.Context, discordId string, tx pgx.Tx) (*items.User, error) {
 	pr := &items.Principal{}
 	usr := &items.User{}
 	dis := &items.DiscordAccount{}
@@ -113,15 +161,17 @@ func (m *DiscordModule) FindUser(ctx context.Context, username string, tx pgx.Tx
 		pr.last_login,
 		pr.state,
 		dis.id,
+		dis.discord_id,
 		dis.username,
 		dis.created,
 		dis.updated,
-		dis.api_response
+		dis.api_response,
+		dis.reauth_required
 	FROM users u
 	JOIN discord_accounts dis ON u.id = dis.user_id
 	JOIN principals pr ON pr.id = u.principal_id
-	WHERE dis.username = $1
-	`, username)
+	WHERE dis.discord_id = $1
+	`, discordId)
 	if err != nil {
 		return nil, err
 	}
@@ -138,10 +188,12 @@ func (m *DiscordModule) FindUser(ctx context.Context, username string, tx pgx.Tx
 			&pr.LastLogin,
 			&pr.State,
 			&dis.Id,
+			&dis.DiscordId,
 			&dis.Username,
 			&dis.Created,
 			&dis.Updated,
 			&dis.ApiResponse,
+			&dis.ReauthRequired,
 		)
 	}
 	if err := rows.Err(); err != nil {
@@ -157,3 +209,53 @@ func (m *DiscordModule) FindUser(ctx context.Context, username string, tx pgx.Tx
 	usr.Discord = dis
 	return usr, nil
 }
+
+// Return every discord account linked to user.
+func (m *DiscordModule) FindAccounts(ctx context.Context, userId uint64, db api.DbConn) ([]*items.DiscordAccount, error) {
+	out := make([]*items.DiscordAccount, 0)
+	rows, err := db.Query(ctx, `
+	SELECT id, user_id, discord_id, username, api_response, created, updated, reauth_required
+	FROM discord_accounts
+	WHERE user_id = $1
+	ORDER BY id
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		dis := &items.DiscordAccount{}
+		err = rows.Scan(
+			&dis.Id,
+			&dis.UserId,
+			&dis.DiscordId,
+			&dis.Username,
+			&dis.ApiResponse,
+			&dis.Created,
+			&dis.Updated,
+			&dis.ReauthRequired,
+		)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dis)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delete discord account of user.
+func (m *DiscordModule) DeleteAccount(ctx context.Context, id uint64, userId uint64, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `
+	DELETE FROM discord_accounts WHERE id = $1 AND user_id = $2
+	`, id, userId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
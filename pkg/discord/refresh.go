@@ -0,0 +1,77 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/jackc/pgx/v4"
+)
+
+// Discord rejected refresh token, user has to log in again
+var ErrReauthRequired = errors.New("discord reauthorization required")
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// Exchange refresh token for a new oauth token.
+func (m *DiscordModule) RefreshToken(ctx context.Context, refreshToken string) (*auth.OauthToken, error) {
+	form := url.Values{}
+	form.Set("client_id", m.config.DiscordClientId)
+	form.Set("client_secret", m.config.DiscordClientSecret)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", API_URL+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		// invalid_grant: refresh token was revoked or already used
+		return nil, ErrReauthRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discord token refresh failed: %v", resp.StatusCode)
+	}
+	var body tokenResponse
+	if err = json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	return &auth.OauthToken{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// Store new token info of account and clear reauth flag.
+func (m *DiscordModule) UpdateTokens(ctx context.Context, id uint64, token *auth.OauthToken, tx pgx.Tx) error {
+	return m.refresher.UpdateTokens(ctx, id, token, tx)
+}
+
+// Refresh tokens of every account expiring soon, see auth.TokenRefresher.
+func (m *DiscordModule) RefreshExpiring(ctx context.Context) (int, error) {
+	return m.refresher.RefreshExpiring(ctx)
+}
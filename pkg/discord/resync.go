@@ -0,0 +1,189 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Refetch profile and guild memberships of account using its stored
+// token and save them, then run sync hooks. Username changes are
+// recorded in history.
+func (m *DiscordModule) Resync(ctx context.Context, acc *items.DiscordAccount, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "discord.resync", nil)
+	defer span.End()
+	fresh, err := m.FetchApi(ctx, &auth.OauthToken{
+		AccessToken: acc.AccessToken,
+		TokenType:   acc.TokenType,
+	})
+	if err != nil {
+		return err
+	}
+	if err = m.SaveProfile(ctx, acc, fresh, tx); err != nil {
+		return err
+	}
+	if err = m.SyncGuilds(ctx, acc, tx); err != nil {
+		return err
+	}
+	for _, hook := range m.hooks {
+		if err = hook(ctx, acc.UserId, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store freshly fetched profile of account.
+// Username changes are recorded in history.
+func (m *DiscordModule) SaveProfile(ctx context.Context, acc *items.DiscordAccount, fresh *items.DiscordAccount, tx pgx.Tx) error {
+	span := tracer.SpanFromContext(ctx)
+	if fresh.Username != acc.Username {
+		span.AddEvent("username changed", trace.WithAttributes(
+			attribute.Int64("discord.id", int64(acc.Id)),
+		))
+		_, err := tx.Exec(ctx, `
+		INSERT INTO discord_username_history (
+			account_id, old_username, new_username, changed
+		) VALUES ($1, $2, $3, now())
+		`, acc.Id, acc.Username, fresh.Username)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(ctx, `
+	UPDATE discord_accounts SET
+		username = $2,
+		api_response = $3,
+		updated = now(),
+		synced = now()
+	WHERE id = $1
+	`, acc.Id, fresh.Username, fresh.ApiResponse)
+	if err != nil {
+		return err
+	}
+	acc.Username = fresh.Username
+	acc.ApiResponse = fresh.ApiResponse
+	return nil
+}
+
+// Username changes of account, newest first.
+func (m *DiscordModule) UsernameHistory(ctx context.Context, id uint64, db api.DbConn) ([]*items.DiscordUsernameChange, error) {
+	out := make([]*items.DiscordUsernameChange, 0)
+	rows, err := db.Query(ctx, `
+	SELECT old_username, new_username, changed
+	FROM discord_username_history
+	WHERE account_id = $1
+	ORDER BY changed DESC, id DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ch := &items.DiscordUsernameChange{}
+		if err = rows.Scan(&ch.OldUsername, &ch.NewUsername, &ch.Changed); err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *DiscordModule) resyncLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		n, err := m.ResyncStale(ctx)
+		if err != nil {
+			log.Println("discord resync:", err)
+		} else if n > 0 {
+			log.Println("discord profiles resynced:", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Resync every account with a valid token not synced for
+// DiscordResyncInterval. Safe to run on several replicas.
+func (m *DiscordModule) ResyncStale(ctx context.Context) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, "discord.resync_stale", nil)
+	defer span.End()
+	count := 0
+	for {
+		done, err := m.resyncNext(ctx)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "resync error")
+			return count, err
+		}
+		if done {
+			return count, nil
+		}
+		count++
+	}
+}
+
+func (m *DiscordModule) resyncNext(ctx context.Context) (bool, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	acc := &items.DiscordAccount{}
+	err = tx.QueryRow(ctx, `
+	SELECT id, user_id, discord_id, username, access_token, token_type FROM discord_accounts
+	WHERE NOT reauth_required AND token_expires_in > now()
+	AND (synced IS NULL OR synced < $1)
+	ORDER BY synced NULLS FIRST
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+	`, time.Now().Add(-m.config.DiscordResyncInterval)).Scan(
+		&acc.Id, &acc.UserId, &acc.DiscordId, &acc.Username, &acc.AccessToken, &acc.TokenType,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// savepoint, so failed resync can still be marked as attempted
+	sub, err := tx.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = m.Resync(ctx, acc, sub)
+	if err == nil {
+		err = sub.Commit(ctx)
+	}
+	if err != nil {
+		sub.Rollback(ctx)
+		log.Printf("discord resync of account %v: %s\n", acc.Id, err)
+		reauth := errors.Is(err, ErrReauthRequired)
+		_, err = tx.Exec(ctx, `
+		UPDATE discord_accounts SET
+			synced = now(),
+			reauth_required = reauth_required OR $2
+		WHERE id = $1
+		`, acc.Id, reauth)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, tx.Commit(ctx)
+}
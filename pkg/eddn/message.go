@@ -0,0 +1,209 @@
+package eddn
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+)
+
+// Schema of journal events relayed by EDDN
+const SCHEMA = "https://eddn.edcd.io/schemas/journal/1"
+
+// Largest inflated message accepted
+const MAX_MESSAGE_SIZE = 1024 * 1024
+
+// Journal time of accepted messages has to be within these bounds of the
+// time they reached the EDDN gateway, so old journals replayed by uploaders
+// and wrong clocks do not pass for current standings.
+const (
+	MAX_MESSAGE_AGE = time.Hour
+	MAX_CLOCK_SKEW  = 5 * time.Minute
+)
+
+var (
+	// Message does not carry faction data, not an error
+	ErrSkipped = errors.New("eddn message skipped")
+	ErrSchema  = errors.New("eddn message does not match schema")
+)
+
+type Header struct {
+	UploaderId       string `json:"uploaderID"`
+	SoftwareName     string `json:"softwareName"`
+	SoftwareVersion  string `json:"softwareVersion"`
+	GatewayTimestamp string `json:"gatewayTimestamp"`
+}
+
+type FactionState struct {
+	State string `json:"State"`
+}
+
+type Faction struct {
+	Name             string         `json:"Name"`
+	Influence        *float64       `json:"Influence"`
+	FactionState     string         `json:"FactionState"`
+	Happiness        string         `json:"Happiness"`
+	ActiveStates     []FactionState `json:"ActiveStates"`
+	PendingStates    []FactionState `json:"PendingStates"`
+	RecoveringStates []FactionState `json:"RecoveringStates"`
+}
+
+type ConflictFaction struct {
+	Name    string `json:"Name"`
+	Stake   string `json:"Stake"`
+	WonDays int    `json:"WonDays"`
+}
+
+// War or election in system, status is empty when it is over
+type Conflict struct {
+	WarType  string          `json:"WarType"`
+	Status   string          `json:"Status"`
+	Faction1 ConflictFaction `json:"Faction1"`
+	Faction2 ConflictFaction `json:"Faction2"`
+}
+
+// FSDJump or Location journal event relayed by EDDN
+type Message struct {
+	Header     Header
+	Event      string
+	Timestamp  time.Time
+	StarSystem string
+	Factions   []Faction
+	Conflicts  []Conflict
+	// raw journal event
+	Data []byte
+}
+
+// Inflate and validate raw EDDN message. Messages of other schemas
+// and events are ErrSkipped.
+func Decode(raw []byte) (*Message, error) {
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	defer r.Close()
+	body, err := io.ReadAll(io.LimitReader(r, MAX_MESSAGE_SIZE+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	if len(body) > MAX_MESSAGE_SIZE {
+		return nil, fmt.Errorf("%w: message is larger than %d bytes", ErrSchema, MAX_MESSAGE_SIZE)
+	}
+	var envelope struct {
+		SchemaRef string          `json:"$schemaRef"`
+		Header    *Header         `json:"header"`
+		Message   json.RawMessage `json:"message"`
+	}
+	if err = json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	if envelope.SchemaRef != SCHEMA {
+		return nil, ErrSkipped
+	}
+	h := envelope.Header
+	if h == nil || h.UploaderId == "" || h.SoftwareName == "" || h.SoftwareVersion == "" {
+		return nil, fmt.Errorf("%w: incomplete header", ErrSchema)
+	}
+	var event struct {
+		Event      string     `json:"event"`
+		StarSystem string     `json:"StarSystem"`
+		Factions   []Faction  `json:"Factions"`
+		Conflicts  []Conflict `json:"Conflicts"`
+	}
+	if err = json.Unmarshal(envelope.Message, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	if event.Event != "FSDJump" && event.Event != "Location" {
+		return nil, ErrSkipped
+	}
+	ev, err := journal.Validate(envelope.Message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	gateway, err := time.Parse(time.RFC3339Nano, h.GatewayTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid gateway timestamp", ErrSchema)
+	}
+	if ev.Timestamp.After(gateway.Add(MAX_CLOCK_SKEW)) {
+		return nil, fmt.Errorf("%w: timestamp is ahead of gateway", ErrSchema)
+	}
+	if ev.Timestamp.Before(gateway.Add(-MAX_MESSAGE_AGE)) {
+		return nil, fmt.Errorf("%w: timestamp is older than %v", ErrSchema, MAX_MESSAGE_AGE)
+	}
+	for i, f := range event.Factions {
+		if f.Name == "" || f.Influence == nil {
+			return nil, fmt.Errorf("%w: faction %d is incomplete", ErrSchema, i)
+		}
+	}
+	for i, c := range event.Conflicts {
+		if c.WarType == "" || c.Faction1.Name == "" || c.Faction2.Name == "" {
+			return nil, fmt.Errorf("%w: conflict %d is incomplete", ErrSchema, i)
+		}
+	}
+	return &Message{
+		Header:     *h,
+		Event:      event.Event,
+		Timestamp:  ev.Timestamp,
+		StarSystem: event.StarSystem,
+		Factions:   event.Factions,
+		Conflicts:  event.Conflicts,
+		Data:       envelope.Message,
+	}, nil
+}
+
+// Journal reports happiness as a localisation key, $Faction_HappinessBand1;
+// is the happiest.
+func happiness(key string) string {
+	var band int
+	if _, err := fmt.Sscanf(key, "$Faction_HappinessBand%d;", &band); err != nil {
+		return ""
+	}
+	if band < 1 || band > len(factions.HAPPINESS) {
+		return ""
+	}
+	return factions.HAPPINESS[band-1]
+}
+
+func stateNames(states []FactionState) []string {
+	out := make([]string, 0, len(states))
+	for _, s := range states {
+		if s.State != "" {
+			out = append(out, s.State)
+		}
+	}
+	return out
+}
+
+// Snapshot of faction standing in system, observed at tick.
+func (f *Faction) Snapshot(system string, tick time.Time) *factions.InfluenceSnapshot {
+	active := stateNames(f.ActiveStates)
+	if len(active) == 0 && f.FactionState != "" && !strings.EqualFold(f.FactionState, "None") {
+		active = []string{f.FactionState}
+	}
+	return &factions.InfluenceSnapshot{
+		System:           system,
+		Tick:             tick,
+		Influence:        *f.Influence,
+		Happiness:        happiness(f.Happiness),
+		ActiveStates:     active,
+		PendingStates:    stateNames(f.PendingStates),
+		RecoveringStates: stateNames(f.RecoveringStates),
+	}
+}
+
+// Conflict as observed by the snapshot of its system.
+func (c *Conflict) Observation() *factions.ConflictObservation {
+	return &factions.ConflictObservation{
+		WarType:  c.WarType,
+		Status:   c.Status,
+		Faction1: factions.ConflictSide{Name: c.Faction1.Name, Stake: c.Faction1.Stake, WonDays: c.Faction1.WonDays},
+		Faction2: factions.ConflictSide{Name: c.Faction2.Name, Stake: c.Faction2.Stake, WonDays: c.Faction2.WonDays},
+	}
+}
@@ -0,0 +1,121 @@
+package eddn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Recorded relay messages, compressed the way EDDN sends them
+func recorded(t *testing.T) [][]byte {
+	f, err := os.Open("testdata/messages.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out := make([][]byte, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), MAX_MESSAGE_SIZE)
+	for scanner.Scan() {
+		out = append(out, deflate(scanner.Bytes()))
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func deflate(raw []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(raw)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	messages := recorded(t)
+	msg, err := Decode(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "FSDJump" || msg.StarSystem != "Jotun" || len(msg.Factions) != 3 {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	s := msg.Factions[0].Snapshot(msg.StarSystem, msg.Timestamp)
+	if s.Influence != 0.452 || s.Happiness != "Happy" || s.ActiveStates[0] != "Boom" || s.PendingStates[0] != "Expansion" {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	if !s.Tick.Equal(msg.Timestamp) || msg.Timestamp.IsZero() {
+		t.Errorf("snapshot tick %v is not message time %v", s.Tick, msg.Timestamp)
+	}
+	// FactionState None means no active state
+	if s = msg.Factions[1].Snapshot(msg.StarSystem, msg.Timestamp); len(s.ActiveStates) != 0 || s.Happiness != "Discontented" {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	for _, i := range []int{1, 2} {
+		if _, err = Decode(messages[i]); !errors.Is(err, ErrSkipped) {
+			t.Errorf("message %d: expected ErrSkipped, got %v", i, err)
+		}
+	}
+	if _, err = Decode(messages[3]); !errors.Is(err, ErrSchema) {
+		t.Errorf("expected ErrSchema for location without StarPos, got %v", err)
+	}
+	if _, err = Decode([]byte("not zlib")); !errors.Is(err, ErrSchema) {
+		t.Errorf("expected ErrSchema for garbage, got %v", err)
+	}
+	if msg, err = Decode(messages[4]); err != nil || msg.Factions[0].Snapshot(msg.StarSystem, msg.Timestamp).Happiness != "Elated" {
+		t.Errorf("unexpected location %+v, %v", msg, err)
+	}
+}
+
+func TestDecodeConflicts(t *testing.T) {
+	msg, err := Decode(recorded(t)[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Conflicts) != 2 {
+		t.Fatalf("expected 2 conflicts, got %+v", msg.Conflicts)
+	}
+	o := msg.Conflicts[0].Observation()
+	if o.WarType != "war" || o.Status != "active" || o.Faction1.Name != "Close Encounters Corps" ||
+		o.Faction1.Stake != "Cooper Gateway" || o.Faction1.WonDays != 2 || o.Faction2.WonDays != 1 {
+		t.Errorf("unexpected observation %+v", o)
+	}
+	if o = msg.Conflicts[1].Observation(); o.WarType != "election" || o.Status != "pending" {
+		t.Errorf("unexpected observation %+v", o)
+	}
+}
+
+func TestDecodeTimestamp(t *testing.T) {
+	f, err := os.ReadFile("testdata/messages.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// FSDJump of 2022-03-01T17:12:03Z
+	jump := string(bytes.SplitN(f, []byte("\n"), 2)[0])
+	cases := map[string]bool{
+		"2022-03-01T17:12:03Z": true,
+		"2022-03-01T16:30:00Z": true,
+		"2022-03-01T17:15:00Z": true,
+		"2022-03-01T18:00:00Z": false,
+		"2022-02-27T17:12:03Z": false,
+	}
+	for timestamp, valid := range cases {
+		raw := strings.Replace(jump, `"timestamp": "2022-03-01T17:12:03Z"`, `"timestamp": "`+timestamp+`"`, 1)
+		_, err := Decode(deflate([]byte(raw)))
+		if valid && err != nil {
+			t.Errorf("%s: %v", timestamp, err)
+		} else if !valid && !errors.Is(err, ErrSchema) {
+			t.Errorf("%s: expected ErrSchema, got %v", timestamp, err)
+		}
+	}
+	raw := strings.Replace(jump, `"gatewayTimestamp": "2022-03-01T17:12:05.123456Z"`, `"gatewayTimestamp": "yesterday"`, 1)
+	if _, err = Decode(deflate([]byte(raw))); !errors.Is(err, ErrSchema) {
+		t.Errorf("expected ErrSchema for invalid gateway timestamp, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package eddn
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/go-zeromq/zmq4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var MODULE_NAME = "eddn"
+
+// Public EDDN relay
+const RELAY = "tcp://eddn.edcd.io:9500"
+
+const (
+	// Relay silent for this long is considered dead and redialed
+	IDLE_TIMEOUT = 5 * time.Minute
+	// Longest pause between reconnects
+	MAX_BACKOFF = time.Minute
+	// How often to reload names of registered factions
+	NAMES_TTL = time.Minute
+)
+
+// Handles decoded message, errors are logged and the message is dropped
+type Handler func(ctx context.Context, msg *Message) error
+
+func NewEddnModule(fm *factions.FactionModule, db *pgxpool.Pool, cfg *config.Config) *EddnModule {
+	m := &EddnModule{
+		relay:    cfg.EddnRelay,
+		idle:     IDLE_TIMEOUT,
+		db:       db,
+		factions: fm,
+	}
+	m.handle = m.store
+	return m
+}
+
+// Consumes EDDN journal messages and records influence
+// of registered factions
+type EddnModule struct {
+	relay    string
+	idle     time.Duration
+	handle   Handler
+	db       *pgxpool.Pool
+	factions *factions.FactionModule
+	// lowercase faction name to id, used by the consumer goroutine only
+	names  map[string]uint64
+	loaded time.Time
+}
+
+func (m *EddnModule) Start(ctx context.Context) error {
+	if m.relay != "" {
+		go m.run(ctx)
+	}
+	return nil
+}
+
+// Consume relay until ctx is done, reconnecting with backoff.
+func (m *EddnModule) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		n, err := m.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if n > 0 {
+			backoff = time.Second
+		}
+		log.Println("eddn:", err, "reconnecting in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > MAX_BACKOFF {
+			backoff = MAX_BACKOFF
+		}
+	}
+}
+
+// Receive messages from one connection to relay until it fails
+// or stays silent for m.idle. Returns number of received messages.
+func (m *EddnModule) consume(ctx context.Context) (int, error) {
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub := zmq4.NewSub(rctx, zmq4.WithDialerTimeout(10*time.Second))
+	defer sub.Close()
+	if err := sub.Dial(m.relay); err != nil {
+		return 0, err
+	}
+	if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+		return 0, err
+	}
+	// zmq4 does not notice a half-open connection, so
+	// cancel receiving when relay is silent for too long
+	alive := make(chan struct{}, 1)
+	go func() {
+		timer := time.NewTimer(m.idle)
+		defer timer.Stop()
+		for {
+			select {
+			case <-rctx.Done():
+				return
+			case <-alive:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(m.idle)
+			case <-timer.C:
+				cancel()
+				return
+			}
+		}
+	}()
+	n := 0
+	for {
+		msg, err := sub.Recv()
+		if err != nil {
+			if rctx.Err() != nil && ctx.Err() == nil {
+				return n, errors.New("relay is idle")
+			}
+			return n, err
+		}
+		n++
+		select {
+		case alive <- struct{}{}:
+		default:
+		}
+		if len(msg.Frames) == 0 {
+			continue
+		}
+		if err = m.process(ctx, msg.Frames[0]); err != nil {
+			log.Println("eddn:", err)
+		}
+	}
+}
+
+func (m *EddnModule) process(ctx context.Context, raw []byte) error {
+	msg, err := Decode(raw)
+	if errors.Is(err, ErrSkipped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.handle(ctx, msg)
+}
+
+// Ids of registered factions by lowercase name.
+func (m *EddnModule) factionIds(ctx context.Context) (map[string]uint64, error) {
+	if m.names != nil && time.Since(m.loaded) < NAMES_TTL {
+		return m.names, nil
+	}
+	names, err := m.factions.Ids(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	m.names, m.loaded = names, time.Now()
+	return names, nil
+}
+
+// Record standing and conflicts of registered factions present in message.
+func (m *EddnModule) store(ctx context.Context, msg *Message) error {
+	names, err := m.factionIds(ctx)
+	if err != nil {
+		return err
+	}
+	snapshots := make(map[uint64]*factions.InfluenceSnapshot)
+	for _, f := range msg.Factions {
+		if id, ok := names[strings.ToLower(f.Name)]; ok {
+			snapshots[id] = f.Snapshot(msg.StarSystem, msg.Timestamp)
+		}
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	ctx, span := tracer.NewSpan(ctx, "eddn.store", nil)
+	defer span.End()
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	stored := 0
+	for id, s := range snapshots {
+		ok, err := m.factions.RecordInfluence(ctx, id, s, tx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			stored++
+		}
+	}
+	observations := make([]*factions.ConflictObservation, 0, len(msg.Conflicts))
+	for i := range msg.Conflicts {
+		observations = append(observations, msg.Conflicts[i].Observation())
+	}
+	conflicts, err := m.factions.UpdateConflicts(ctx, msg.StarSystem, msg.Timestamp, observations, tx)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("eddn.system", msg.StarSystem),
+		attribute.Int("eddn.stored", stored),
+		attribute.Int("eddn.conflicts", conflicts),
+	)
+	return tx.Commit(ctx)
+}
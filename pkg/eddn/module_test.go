@@ -0,0 +1,104 @@
+package eddn
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// Local relay replaying recorded messages until stopped
+func replay(t *testing.T, ctx context.Context, endpoint string, messages [][]byte) (string, func()) {
+	pub := zmq4.NewPub(ctx)
+	if err := pub.Listen(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if len(messages) > 0 {
+				pub.Send(zmq4.NewMsg(messages[i%len(messages)]))
+			}
+		}
+	}()
+	return "tcp://" + pub.Addr().String(), func() {
+		close(done)
+		<-stopped
+		pub.Close()
+	}
+}
+
+type received struct {
+	mu      sync.Mutex
+	systems map[string]int
+}
+
+func (r *received) handle(ctx context.Context, msg *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.systems[msg.StarSystem]++
+	return nil
+}
+
+func (r *received) wait(t *testing.T, system string, n int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		got := r.systems[system]
+		r.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("%d messages of %s not received", n, system)
+}
+
+func TestConsumeReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay, stop := replay(t, ctx, "tcp://127.0.0.1:0", recorded(t))
+	r := &received{systems: make(map[string]int)}
+	m := &EddnModule{relay: relay, idle: time.Minute, handle: r.handle}
+	go m.run(ctx)
+	r.wait(t, "Jotun", 1)
+	r.wait(t, "Achenar", 1)
+	// relay restarts, consumer reconnects
+	stop()
+	r.mu.Lock()
+	before := r.systems["Jotun"]
+	r.mu.Unlock()
+	_, stop = replay(t, ctx, relay, recorded(t))
+	defer stop()
+	r.wait(t, "Jotun", before+1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.systems["Sol"] != 0 {
+		t.Error("skipped and invalid messages were handled")
+	}
+}
+
+func TestConsumeIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay, stop := replay(t, ctx, "tcp://127.0.0.1:0", nil)
+	defer stop()
+	m := &EddnModule{relay: relay, idle: 100 * time.Millisecond}
+	start := time.Now()
+	_, err := m.consume(ctx)
+	if err == nil || err.Error() != "relay is idle" {
+		t.Fatalf("expected idle relay, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("idle relay was not noticed in time")
+	}
+}
@@ -0,0 +1,78 @@
+package facades
+
+import (
+	"context"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Open conflicts, of faction when factionId is not 0, most urgent first.
+func (f *CoreFacade) ActiveConflicts(ctx context.Context, factionId uint64) ([]*factions.Conflict, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.active_conflicts", nil)
+	defer span.End()
+	if factionId != 0 {
+		if _, err := f.factions.FindOne(ctx, factionId, f.db); err != nil {
+			return nil, err
+		}
+	}
+	return f.factions.ActiveConflicts(ctx, factionId, f.db)
+}
+
+func (f *CoreFacade) FactionConflicts(ctx context.Context, factionId uint64) ([]*factions.Conflict, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.faction_conflicts", nil)
+	defer span.End()
+	if _, err := f.factions.FindOne(ctx, factionId, f.db); err != nil {
+		return nil, err
+	}
+	return f.factions.FactionConflicts(ctx, factionId, f.db)
+}
+
+// Update conflicts of system from snapshot submitted by approved member usr.
+func (f *CoreFacade) SubmitConflicts(ctx context.Context, usr *items.User, system string, observed time.Time, observations []*factions.ConflictObservation) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.submit_conflicts", nil)
+	defer span.End()
+	if !usr.Principal.Admin && usr.Principal.State != items.StateApproved {
+		return 0, ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	changed, err := f.factions.UpdateConflicts(ctx, system, observed, observations, tx)
+	if err != nil {
+		return 0, err
+	}
+	span.AddEvent("conflicts submitted", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.String("conflicts.system", system),
+		attribute.Int("conflicts.changed", changed),
+	))
+	return changed, tx.Commit(ctx)
+}
+
+func (f *CoreFacade) OverrideConflict(ctx context.Context, admin *items.User, conflict *factions.Conflict) error {
+	ctx, span := tracer.NewSpan(ctx, "core.override_conflict", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.factions.OverrideConflict(ctx, conflict, tx); err != nil {
+		return err
+	}
+	span.AddEvent("conflict overridden", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("conflict.id", int64(conflict.Id)),
+	))
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,105 @@
+package facades
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+)
+
+func TestConflictTracker(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative", SquadronSupported: true}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	war := func(status string, ours, theirs int) *factions.ConflictObservation {
+		return &factions.ConflictObservation{
+			WarType:  "war",
+			Status:   status,
+			Faction1: factions.ConflictSide{Name: "Tiethay Blue Mafia", WonDays: theirs},
+			Faction2: factions.ConflictSide{Name: "close encounters corps", Stake: "Cooper Gateway", WonDays: ours},
+		}
+	}
+	election := &factions.ConflictObservation{
+		WarType:  "election",
+		Status:   "active",
+		Faction1: factions.ConflictSide{Name: "Tiethay Purple Holdings"},
+		Faction2: factions.ConflictSide{Name: "Tiethay Gold Vision Ltd"},
+	}
+	// snapshots from the future are rejected, so the conflict starts days ago
+	seen := time.Now().Truncate(time.Second).Add(-72 * time.Hour)
+	changed, err := fcm.UpdateConflicts(env.ctx, "Tiethay", seen, []*factions.ConflictObservation{war("pending", 0, 0), election}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// election of factions we do not support is not tracked
+	if changed != 1 {
+		t.Errorf("expected 1 changed conflict, got %d", changed)
+	}
+	if _, err = fcm.UpdateConflicts(env.ctx, "Tiethay", seen.Add(24*time.Hour), []*factions.ConflictObservation{war("active", 2, 1)}, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	// snapshots observed earlier but relayed late change nothing
+	for _, late := range [][]*factions.ConflictObservation{{war("active", 1, 1)}, nil} {
+		changed, err = fcm.UpdateConflicts(env.ctx, "Tiethay", seen.Add(12*time.Hour), late, env.tx)
+		if err != nil || changed != 0 {
+			t.Errorf("late snapshot changed %d conflicts, %v", changed, err)
+		}
+	}
+	active, err := fcm.ActiveConflicts(env.ctx, faction.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 {
+		t.Fatalf("expected 1 active conflict, got %d", len(active))
+	}
+	c := active[0]
+	if c.Status != factions.CONFLICT_ACTIVE || c.Faction2.Name != faction.Name ||
+		c.Faction2.WonDays != 2 || c.Faction1.WonDays != 1 || !c.Faction2.Supported || c.DaysLeft != 2 || c.Margin() != 1 {
+		t.Errorf("unexpected conflict %+v", c)
+	}
+	// one snapshot from the future would shadow every later one
+	future := time.Now().Add(24 * time.Hour)
+	if _, err = fcm.UpdateConflicts(env.ctx, "Tiethay", future, []*factions.ConflictObservation{war("active", 4, 1)}, env.tx); !errors.Is(err, factions.ErrInvalidConflict) {
+		t.Errorf("expected ErrInvalidConflict for future snapshot, got %v", err)
+	}
+	if _, err = fcm.UpdateConflicts(env.ctx, strings.Repeat("x", factions.MAX_SYSTEM+1), seen, nil, env.tx); !errors.Is(err, factions.ErrInvalidConflict) {
+		t.Errorf("expected ErrInvalidConflict for long system, got %v", err)
+	}
+	// an admin freezes the conflict, snapshots no longer change it
+	override := &factions.Conflict{Id: c.Id, Status: factions.CONFLICT_ACTIVE, Faction1: c.Faction1, Faction2: c.Faction2, Manual: true}
+	override.Faction2.WonDays = 3
+	if err = fcm.OverrideConflict(env.ctx, override, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fcm.UpdateConflicts(env.ctx, "Tiethay", seen.Add(48*time.Hour), []*factions.ConflictObservation{war("active", 2, 2)}, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = fcm.FindConflict(env.ctx, c.Id, env.tx); err != nil || c.Faction2.WonDays != 3 || c.Faction1.WonDays != 1 {
+		t.Errorf("manual conflict was changed: %+v, %v", c, err)
+	}
+	override.Manual = false
+	if err = fcm.OverrideConflict(env.ctx, override, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	// conflict is over once it disappears from a snapshot taken after the override
+	if _, err = fcm.UpdateConflicts(env.ctx, "Tiethay", time.Now().Add(time.Second), nil, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = fcm.FindConflict(env.ctx, c.Id, env.tx); err != nil || c.Status != factions.CONFLICT_ENDED || c.Ended == nil ||
+		c.Outcome != c.Faction2.Name {
+		t.Errorf("unexpected ended conflict %+v, %v", c, err)
+	}
+	if active, err = fcm.ActiveConflicts(env.ctx, 0, env.tx); err != nil || len(active) != 0 {
+		t.Errorf("expected no active conflicts, got %v, %v", active, err)
+	}
+	all, err := fcm.FactionConflicts(env.ctx, faction.Id, env.tx)
+	if err != nil || len(all) != 1 {
+		t.Errorf("expected 1 conflict of faction, got %v, %v", all, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"time"
@@ -14,7 +15,12 @@ import (
 	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/frontier"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/rules"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
 	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
 	"github.com/jackc/pgx/v4"
@@ -25,19 +31,36 @@ import (
 
 var CORE_FACADE = "auth_facade"
 
+var (
+	ErrForbidden       = errors.New("forbidden")
+	ErrAccountLinked   = errors.New("account is linked to another user")
+	ErrLastLoginMethod = errors.New("cannot unlink last login method")
+	ErrAmbiguous       = errors.New("several accounts linked, specify id")
+)
+
 func NewCoreFacade(
 	db *pgxpool.Pool,
 	um *users.UserModule,
 	dm *discord.DiscordModule,
+	fm *frontier.FrontierModule,
 	tm *tokens.TokenModule,
+	rm *rules.RuleModule,
+	jm *journal.JournalModule,
+	fcm *factions.FactionModule,
+	om *ops.OpsModule,
 	cfg *config.Config,
 ) *CoreFacade {
 	return &CoreFacade{
-		db:      db,
-		users:   um,
-		discord: dm,
-		tokens:  tm,
-		config:  cfg,
+		db:       db,
+		users:    um,
+		discord:  dm,
+		frontier: fm,
+		tokens:   tm,
+		rules:    rm,
+		journal:  jm,
+		factions: fcm,
+		ops:      om,
+		config:   cfg,
 		auth: &http.Client{
 			Timeout: 2 * time.Second,
 		},
@@ -45,21 +68,26 @@ func NewCoreFacade(
 }
 
 type CoreFacade struct {
-	db      *pgxpool.Pool
-	users   *users.UserModule
-	discord *discord.DiscordModule
-	tokens  *tokens.TokenModule
-	config  *config.Config
-	auth    *http.Client
+	db       *pgxpool.Pool
+	users    *users.UserModule
+	discord  *discord.DiscordModule
+	frontier *frontier.FrontierModule
+	tokens   *tokens.TokenModule
+	rules    *rules.RuleModule
+	journal  *journal.JournalModule
+	factions *factions.FactionModule
+	ops      *ops.OpsModule
+	config   *config.Config
+	auth     *http.Client
 }
 
-func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string) (string, error) {
+func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string, client *items.ClientInfo) (*items.TokenPair, error) {
 	ctx, span := tracer.NewSpan(ctx, "core.authenticate", nil)
 	defer span.End()
 	tx, err := f.db.Begin(ctx)
 	span.AddEvent("tx.begin")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		span.AddEvent("tx.rollback")
@@ -67,11 +95,11 @@ func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string
 	}()
 	authUrl, err := url.Parse(f.config.AuthInternalUrl)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	authUrl, err = authUrl.Parse("/api/exchange")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	q := authUrl.Query()
 	q.Add("secret", f.config.AuthSecret)
@@ -80,15 +108,15 @@ func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string
 	authUrl.RawQuery = q.Encode()
 	req, err := http.NewRequest("GET", authUrl.String(), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	resp, err := f.auth.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		span.AddEvent("response error", trace.WithAttributes(
@@ -98,10 +126,10 @@ func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string
 		if resp.StatusCode == http.StatusBadRequest {
 			switch string(body) {
 			case "state_not_found":
-				return "", fmt.Errorf("state not found")
+				return nil, fmt.Errorf("state not found")
 			}
 		}
-		return "", fmt.Errorf("cec-auth request failed")
+		return nil, fmt.Errorf("cec-auth request failed")
 	}
 	var oauth auth.OauthToken
 	err = json.Unmarshal(body, &oauth)
@@ -109,107 +137,634 @@ func (f *CoreFacade) Authenticate(ctx context.Context, kind string, state string
 		span.AddEvent("error decoding body", trace.WithAttributes(
 			attribute.String("response.body", string(body)),
 		))
-		return "", err
+		return nil, err
 	}
-	var token string
+	var usr *items.User
 	switch kind {
 	case "discord":
-		// fetch account using oauth token
-		account, err := f.discord.FetchApi(ctx, &oauth)
-		if err != nil {
-			return "", err
-		}
-		var usr *items.User
-		// lookup current user from context
-		usr, found := auth.FromContext(ctx)
-		// not found
-		if !found {
-			span.AddEvent("discord not found")
-			// find existing discord account
-			usr, err = f.discord.FindUser(ctx, account.Username, tx)
-			if err != nil {
-				return "", err
-			}
-			msg := "user found"
-			if usr == nil {
-				span.AddEvent("create new user")
-				// not found? firstly, create user
-				usr, err = f.users.NewUser(ctx, tx)
-				if err != nil {
-					return "", err
-				}
-				// then create account and associate it with user
-				id, err := f.discord.NewAccount(ctx, account, usr.Id, tx)
-				if err != nil {
-					return "", err
-				}
-				account.Id = id
-				usr.Discord = account
-				msg = "user created"
-			}
-			span.AddEvent(msg, trace.WithAttributes(
-				attribute.Int64("user.id", int64(usr.Id)),
-				attribute.Int64("principal.id", int64(usr.Principal.Id)),
-			))
-			// create new token as its not authenticated in system atm
-			token, err = f.tokens.NewToken(ctx, usr.Principal, tx)
-			if err != nil {
-				return "", err
-			}
-			span.AddEvent("token created")
-		}
-		err = f.users.Authenticate(ctx, usr.Id, tx)
-		if err != nil {
-			return "", err
-		}
-		span.AddEvent("authenticated successfully")
+		usr, err = f.loginDiscord(ctx, &oauth, tx)
+	case "frontier":
+		usr, err = f.loginFrontier(ctx, &oauth, tx)
+	default:
+		err = fmt.Errorf("unknown login kind %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// new session for the login
+	client.Provider = kind
+	token, err := f.tokens.NewToken(ctx, usr.Principal, client, tx)
+	if err != nil {
+		return nil, err
 	}
+	span.AddEvent("token created")
+	err = f.users.Authenticate(ctx, usr.Id, tx)
+	if err != nil {
+		return nil, err
+	}
+	span.AddEvent("authenticated successfully")
 	err = tx.Commit(ctx)
 	return token, err
 }
 
-func (f *CoreFacade) CurrentUser(ctx context.Context, token string) (*items.User, error) {
+// Fill linked accounts of user resolved from the request token.
+func (f *CoreFacade) CurrentUser(ctx context.Context, user *items.User) (*items.User, error) {
 	ctx, span := tracer.NewSpan(ctx, "core.currentuser", nil)
 	defer span.End()
-	pid, err := f.tokens.FindPrincipalID(ctx, f.db, token)
+	span.SetAttributes(attribute.Int64("user.id", int64(user.Id)))
+	accounts, err := f.discord.FindAccounts(ctx, user.Id, f.db)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("invalid token")
-		}
-		tracer.AddSpanError(span, err)
-		tracer.FailSpan(span, "internal error")
 		return nil, err
 	}
+	if len(accounts) > 0 {
+		user.Discord = accounts[0]
+	}
+	cmdrs, err := f.frontier.FindAccounts(ctx, user.Id, f.db)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmdrs) > 0 {
+		user.Frontier = cmdrs[0]
+		user.Frontier.Commander, err = f.frontier.FindCommander(ctx, user.Frontier.Id, f.db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (f *CoreFacade) PromoteToAdmin(ctx context.Context, token string) error {
+	ctx, span := tracer.NewSpan(ctx, "core.promote_admin", nil)
+	defer span.End()
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return err
+	}
 	span.AddEvent("PID found", trace.WithAttributes(
 		attribute.Int64("principal.id", int64(pid)),
 	))
 	user, err := f.users.FindOneByPrincipal(ctx, pid, f.db)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	span.AddEvent("User found", trace.WithAttributes(
 		attribute.Int64("user.id", int64(user.Id)),
 	))
-	return user, err
+	user.Principal.Admin = true
+	return f.users.Save(ctx, user, f.db)
 }
 
-func (f *CoreFacade) PromoteToAdmin(ctx context.Context, token string) error {
-	ctx, span := tracer.NewSpan(ctx, "core.promote_admin", nil)
+// Exchange refresh token for a new token pair.
+func (f *CoreFacade) RefreshToken(ctx context.Context, refresh string, client *items.ClientInfo) (*items.TokenPair, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.refresh_token", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	pid, pair, err := f.tokens.Refresh(ctx, refresh, client, tx)
+	if err != nil {
+		if errors.Is(err, tokens.ErrTokenReused) {
+			// keep the family revocation
+			if cerr := tx.Commit(ctx); cerr != nil {
+				return nil, cerr
+			}
+		}
+		return nil, err
+	}
+	user, err := f.users.FindOneByPrincipal(ctx, pid, tx)
+	if err != nil {
+		return nil, err
+	}
+	if user.Principal.State == items.StateBlocked {
+		return nil, tokens.ErrInvalidToken
+	}
+	span.AddEvent("token refreshed", trace.WithAttributes(
+		attribute.Int64("principal.id", int64(pid)),
+	))
+	return pair, tx.Commit(ctx)
+}
+
+// Revoke presented token and its refresh token.
+func (f *CoreFacade) Logout(ctx context.Context, token string) error {
+	ctx, span := tracer.NewSpan(ctx, "core.logout", nil)
 	defer span.End()
-	pid, err := f.tokens.FindPrincipalID(ctx, f.db, token)
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = f.loginPrincipal(ctx, token); err != nil {
+		return err
+	}
+	err = f.tokens.Revoke(ctx, token, tokens.REVOKE_LOGOUT, tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Revoke every token of the principal owning presented token.
+func (f *CoreFacade) LogoutAll(ctx context.Context, token string) error {
+	ctx, span := tracer.NewSpan(ctx, "core.logout_all", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	pid, err := f.loginPrincipal(ctx, token)
 	if err != nil {
 		return err
 	}
 	span.AddEvent("PID found", trace.WithAttributes(
 		attribute.Int64("principal.id", int64(pid)),
 	))
-	user, err := f.users.FindOneByPrincipal(ctx, pid, f.db)
+	err = f.tokens.RevokeAll(ctx, pid, tokens.REVOKE_LOGOUT_ALL, tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Revoke every token of another principal. Caller must be an admin.
+func (f *CoreFacade) RevokePrincipalTokens(ctx context.Context, token string, pid uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.revoke_principal_tokens", nil)
+	defer span.End()
+	adminPid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return err
+	}
+	admin, err := f.users.FindOneByPrincipal(ctx, adminPid, f.db)
+	if err != nil {
+		return err
+	}
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+	err = f.tokens.RevokeAll(ctx, pid, tokens.REVOKE_ADMIN, tx)
+	if err != nil {
+		return err
+	}
+	span.AddEvent("tokens revoked", trace.WithAttributes(
+		attribute.Int64("admin.principal.id", int64(admin.Principal.Id)),
+		attribute.Int64("principal.id", int64(pid)),
+	))
+	return tx.Commit(ctx)
+}
+
+// List active sessions of the principal owning token.
+func (f *CoreFacade) Sessions(ctx context.Context, token string) ([]*items.Session, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.sessions", nil)
+	defer span.End()
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return f.tokens.Sessions(ctx, pid, token, f.db)
+}
+
+// Revoke one of the sessions of the principal owning token.
+func (f *CoreFacade) KillSession(ctx context.Context, token string, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.kill_session", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return err
+	}
+	err = f.tokens.RevokeSession(ctx, pid, id, tx)
+	if err != nil {
+		return err
+	}
+	span.AddEvent("session revoked", trace.WithAttributes(
+		attribute.Int64("principal.id", int64(pid)),
+		attribute.Int64("session.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Create API key for the principal owning token.
+// Only login tokens may manage API keys.
+func (f *CoreFacade) CreateApiKey(ctx context.Context, token string, name string, scopes []string, expires *time.Time) (*items.ApiKey, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.create_apikey", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := f.tokens.NewApiKey(ctx, pid, name, scopes, expires, tx)
+	if err != nil {
+		return nil, err
+	}
+	span.AddEvent("api key created", trace.WithAttributes(
+		attribute.Int64("principal.id", int64(pid)),
+		attribute.String("apikey.prefix", key.Prefix),
+	))
+	return key, tx.Commit(ctx)
+}
+
+func (f *CoreFacade) ApiKeys(ctx context.Context, token string) ([]*items.ApiKey, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.apikeys", nil)
+	defer span.End()
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return f.tokens.ApiKeys(ctx, pid, f.db)
+}
+
+func (f *CoreFacade) RevokeApiKey(ctx context.Context, token string, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.revoke_apikey", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	pid, err := f.loginPrincipal(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err = f.tokens.RevokeApiKey(ctx, pid, id, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) Jwks() *tokens.Jwks {
+	return f.tokens.Jwks()
+}
+
+// Resolve login token or API key into its grant and user.
+// Tokens of blocked principals are invalid.
+func (f *CoreFacade) Resolve(ctx context.Context, token string) (*tokens.Grant, *items.User, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.resolve", nil)
+	defer span.End()
+	grant, err := f.tokens.Resolve(ctx, f.db, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := f.users.FindOneByPrincipal(ctx, grant.PrincipalId, f.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Principal.State == items.StateBlocked {
+		return nil, nil, tokens.ErrInvalidToken
+	}
+	user.Guilds, err = f.discord.FindGuilds(ctx, user.Id, f.db)
+	if err != nil {
+		return nil, nil, err
+	}
 	span.AddEvent("User found", trace.WithAttributes(
 		attribute.Int64("user.id", int64(user.Id)),
 	))
-	user.Principal.Admin = true
-	return f.users.Save(ctx, user, f.db)
+	return grant, user, nil
+}
+
+// Principal id owning login token. API keys and tokens
+// of blocked principals are rejected as invalid.
+func (f *CoreFacade) loginPrincipal(ctx context.Context, token string) (uint64, error) {
+	grant, _, err := f.Resolve(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	if grant.ApiKeyId != 0 {
+		return 0, tokens.ErrInvalidToken
+	}
+	return grant.PrincipalId, nil
+}
+
+// Resolve token for another service. Invalid token is not an error,
+// nil grant is returned instead.
+func (f *CoreFacade) Introspect(ctx context.Context, token string) (*tokens.Grant, *items.User, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.introspect", nil)
+	defer span.End()
+	grant, user, err := f.Resolve(ctx, token)
+	if err != nil {
+		if errors.Is(err, tokens.ErrInvalidToken) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return grant, user, nil
+}
+
+// Unlink discord account from user. id may be zero when
+// the user has only one discord account.
+func (f *CoreFacade) UnlinkDiscord(ctx context.Context, usr *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.unlink_discord", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	accounts, err := f.discord.FindAccounts(ctx, usr.Id, tx)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		if len(accounts) > 1 {
+			return ErrAmbiguous
+		}
+		if len(accounts) == 0 {
+			return discord.ErrAccountNotFound
+		}
+		id = accounts[0].Id
+	}
+	methods, err := f.users.LoginMethods(ctx, usr.Id, tx)
+	if err != nil {
+		return err
+	}
+	if methods <= 1 {
+		return ErrLastLoginMethod
+	}
+	err = f.discord.DeleteAccount(ctx, id, usr.Id, tx)
+	if err != nil {
+		return err
+	}
+	span.AddEvent("discord unlinked", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.Int64("discord.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Move every account of source user to target and block source.
+// Used by admins when someone logged in with different accounts
+// and got two users.
+func (f *CoreFacade) MergeUsers(ctx context.Context, admin *items.User, target uint64, source uint64) (*items.User, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.merge_users", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return nil, ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	src, err := f.users.FindOne(ctx, source, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.users.Merge(ctx, target, source, tx); err != nil {
+		return nil, err
+	}
+	// source principal is blocked, its sessions and keys go with it
+	err = f.tokens.RevokeAll(ctx, src.Principal.Id, tokens.REVOKE_ADMIN, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.tokens.RevokeApiKeys(ctx, src.Principal.Id, tx); err != nil {
+		return nil, err
+	}
+	usr, err := f.users.FindOne(ctx, target, tx)
+	if err != nil {
+		return nil, err
+	}
+	span.AddEvent("users merged", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("target.user.id", int64(target)),
+		attribute.Int64("source.user.id", int64(source)),
+	))
+	return usr, tx.Commit(ctx)
+}
+
+// Store profile and tokens of existing discord account fetched on login.
+func (f *CoreFacade) updateDiscord(ctx context.Context, acc *items.DiscordAccount, fresh *items.DiscordAccount, oauth *auth.OauthToken, tx pgx.Tx) error {
+	if err := f.discord.SaveProfile(ctx, acc, fresh, tx); err != nil {
+		return err
+	}
+	fresh.Id = acc.Id
+	return f.discord.UpdateTokens(ctx, acc.Id, oauth, tx)
+}
+
+// Role rules in evaluation order. Caller must be an admin.
+func (f *CoreFacade) RoleRules(ctx context.Context, admin *items.User) ([]*items.RoleRule, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.role_rules", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return nil, ErrForbidden
+	}
+	return f.rules.List(ctx, f.db)
+}
+
+// Store new role rule. It is applied on next login or resync of each user.
+func (f *CoreFacade) CreateRoleRule(ctx context.Context, admin *items.User, rule *items.RoleRule) error {
+	ctx, span := tracer.NewSpan(ctx, "core.create_role_rule", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.rules.Create(ctx, rule, tx); err != nil {
+		return err
+	}
+	span.AddEvent("rule created", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("rule.id", int64(rule.Id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) DeleteRoleRule(ctx context.Context, admin *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.delete_role_rule", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.rules.Delete(ctx, id, tx); err != nil {
+		return err
+	}
+	span.AddEvent("rule deleted", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("rule.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Changes given rules, or stored ones when nil, would make to principals.
+func (f *CoreFacade) DryRunRoleRules(ctx context.Context, admin *items.User, candidates []*items.RoleRule) ([]*items.PrincipalChange, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.dry_run_role_rules", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return nil, ErrForbidden
+	}
+	return f.rules.DryRun(ctx, candidates, f.db)
+}
+
+// Automatic changes made to principal by role rules.
+func (f *CoreFacade) PrincipalAudit(ctx context.Context, admin *items.User, pid uint64) ([]*items.PrincipalChange, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.principal_audit", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return nil, ErrForbidden
+	}
+	return f.rules.Audit(ctx, pid, f.db)
+}
+
+// Find or create user of discord account fetched with oauth token,
+// linking it to user in context if any.
+func (f *CoreFacade) loginDiscord(ctx context.Context, oauth *auth.OauthToken, tx pgx.Tx) (*items.User, error) {
+	span := tracer.SpanFromContext(ctx)
+	// fetch account using oauth token
+	account, err := f.discord.FetchApi(ctx, oauth)
+	if err != nil {
+		return nil, err
+	}
+	var usr *items.User
+	// lookup current user from context
+	usr, found := auth.FromContext(ctx)
+	// find existing discord account
+	owner, err := f.discord.FindUser(ctx, account.DiscordId, tx)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		span.AddEvent("user found in context", trace.WithAttributes(
+			attribute.Int64("user.id", int64(usr.Id)),
+		))
+		if owner != nil && owner.Id != usr.Id {
+			// merging users is up to admins
+			return nil, ErrAccountLinked
+		}
+		if owner != nil {
+			err = f.updateDiscord(ctx, owner.Discord, account, oauth, tx)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// attach discord account to current user
+			id, err := f.discord.NewAccount(ctx, account, usr.Id, tx)
+			if err != nil {
+				return nil, err
+			}
+			account.Id = id
+			usr.Discord = account
+			span.AddEvent("discord linked")
+		}
+	} else {
+		span.AddEvent("discord not found")
+		usr = owner
+		msg := "user found"
+		if usr != nil {
+			err = f.updateDiscord(ctx, usr.Discord, account, oauth, tx)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			span.AddEvent("create new user")
+			// not found? firstly, create user
+			usr, err = f.users.NewUser(ctx, tx)
+			if err != nil {
+				return nil, err
+			}
+			// then create account and associate it with user
+			id, err := f.discord.NewAccount(ctx, account, usr.Id, tx)
+			if err != nil {
+				return nil, err
+			}
+			account.Id = id
+			usr.Discord = account
+			msg = "user created"
+		}
+		span.AddEvent(msg, trace.WithAttributes(
+			attribute.Int64("user.id", int64(usr.Id)),
+			attribute.Int64("principal.id", int64(usr.Principal.Id)),
+		))
+	}
+	// guild membership is best effort, discord hiccups must not block login
+	members, err := f.discord.FetchGuilds(ctx, account)
+	if err != nil {
+		tracer.AddSpanError(span, err)
+		log.Printf("discord guilds of account %v: %s\n", account.Id, err)
+	} else if err = f.discord.SaveGuilds(ctx, account.Id, members, tx); err != nil {
+		return nil, err
+	}
+	changes, err := f.rules.Apply(ctx, usr.Id, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		// token claims must carry the new admin flag and state
+		fresh, err := f.users.FindOne(ctx, usr.Id, tx)
+		if err != nil {
+			return nil, err
+		}
+		usr.Principal = fresh.Principal
+		span.AddEvent("role rules applied")
+	}
+	return usr, nil
+}
+
+// Find or create user of frontier commander fetched with oauth token,
+// linking it to user in context if any.
+func (f *CoreFacade) loginFrontier(ctx context.Context, oauth *auth.OauthToken, tx pgx.Tx) (*items.User, error) {
+	span := tracer.SpanFromContext(ctx)
+	account, err := f.frontier.FetchApi(ctx, oauth)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := f.frontier.FindUser(ctx, account.Cmdr, tx)
+	if err != nil {
+		return nil, err
+	}
+	usr, found := auth.FromContext(ctx)
+	if found && owner != nil && owner.Id != usr.Id {
+		// merging users is up to admins
+		return nil, ErrAccountLinked
+	}
+	if owner != nil {
+		account.Id = owner.Frontier.Id
+		if err = f.frontier.UpdateAccount(ctx, account.Id, account, tx); err != nil {
+			return nil, err
+		}
+		owner.Frontier = account
+		span.AddEvent("user found", trace.WithAttributes(
+			attribute.Int64("user.id", int64(owner.Id)),
+		))
+		return owner, nil
+	}
+	if !found {
+		span.AddEvent("create new user")
+		usr, err = f.users.NewUser(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	account.Id, err = f.frontier.NewAccount(ctx, account, usr.Id, tx)
+	if err != nil {
+		return nil, err
+	}
+	usr.Frontier = account
+	span.AddEvent("frontier linked", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+	))
+	return usr, nil
 }
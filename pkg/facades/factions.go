@@ -0,0 +1,166 @@
+package facades
+
+import (
+	"context"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (f *CoreFacade) Factions(ctx context.Context, filter *factions.Filter) ([]*factions.GameFaction, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.factions", nil)
+	defer span.End()
+	return f.factions.Search(ctx, filter, f.db)
+}
+
+func (f *CoreFacade) Faction(ctx context.Context, id uint64) (*factions.GameFaction, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.faction", nil)
+	defer span.End()
+	return f.factions.FindOne(ctx, id, f.db)
+}
+
+func (f *CoreFacade) CreateFaction(ctx context.Context, admin *items.User, faction *factions.GameFaction) error {
+	ctx, span := tracer.NewSpan(ctx, "core.create_faction", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.factions.Create(ctx, faction, tx); err != nil {
+		return err
+	}
+	span.AddEvent("faction created", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("faction.id", int64(faction.Id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) UpdateFaction(ctx context.Context, admin *items.User, faction *factions.GameFaction) error {
+	ctx, span := tracer.NewSpan(ctx, "core.update_faction", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.factions.Update(ctx, faction, tx); err != nil {
+		return err
+	}
+	span.AddEvent("faction updated", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("faction.id", int64(faction.Id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) DeleteFaction(ctx context.Context, admin *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.delete_faction", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.factions.Delete(ctx, id, tx); err != nil {
+		return err
+	}
+	span.AddEvent("faction deleted", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("faction.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Store BGS snapshots of faction submitted by approved member usr.
+func (f *CoreFacade) IngestInfluence(ctx context.Context, usr *items.User, factionId uint64, snapshots []*factions.InfluenceSnapshot) error {
+	ctx, span := tracer.NewSpan(ctx, "core.ingest_influence", nil)
+	defer span.End()
+	if !usr.Principal.Admin && usr.Principal.State != items.StateApproved {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = f.factions.FindOne(ctx, factionId, tx); err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		s.SubmittedBy = &usr.Id
+	}
+	if err = f.factions.SaveInfluence(ctx, factionId, snapshots, tx); err != nil {
+		return err
+	}
+	span.AddEvent("influence saved", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.Int64("faction.id", int64(factionId)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Influence of faction over last days, in one system or all of them.
+func (f *CoreFacade) InfluenceHistory(ctx context.Context, factionId uint64, system string, days int) ([]*factions.InfluenceSnapshot, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.influence_history", nil)
+	defer span.End()
+	if _, err := f.factions.FindOne(ctx, factionId, f.db); err != nil {
+		return nil, err
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	return f.factions.InfluenceHistory(ctx, factionId, system, since, f.db)
+}
+
+func (f *CoreFacade) InfluenceDrops(ctx context.Context, factionId uint64, threshold float64) ([]*factions.InfluenceDrop, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.influence_drops", nil)
+	defer span.End()
+	if _, err := f.factions.FindOne(ctx, factionId, f.db); err != nil {
+		return nil, err
+	}
+	return f.factions.Drops(ctx, factionId, threshold, f.db)
+}
+
+// Most recent detected BGS ticks.
+func (f *CoreFacade) Ticks(ctx context.Context, limit int) ([]*factions.Tick, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.ticks", nil)
+	defer span.End()
+	return f.factions.Ticks(ctx, limit, f.db)
+}
+
+// Report on supported faction at tick, latest tick when tickId is 0.
+func (f *CoreFacade) FactionReport(ctx context.Context, factionId uint64, tickId uint64) (*factions.Report, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.faction_report", nil)
+	defer span.End()
+	faction, err := f.factions.FindOne(ctx, factionId, f.db)
+	if err != nil {
+		return nil, err
+	}
+	var tick *factions.Tick
+	if tickId == 0 {
+		tick, err = f.factions.LastTick(ctx, f.db)
+	} else {
+		tick, err = f.factions.FindTick(ctx, tickId, f.db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int64("faction.id", int64(factionId)),
+		attribute.Int64("tick.id", int64(tick.Id)),
+	)
+	return f.factions.Report(ctx, faction, tick, f.db)
+}
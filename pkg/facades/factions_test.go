@@ -0,0 +1,285 @@
+package facades
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/factions"
+)
+
+func TestFactionRegistry(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{
+		Name:              "Close Encounters Corps",
+		Allegiance:        "Independent",
+		Government:        "Cooperative",
+		HomeSystem:        "Jotun",
+		SquadronSupported: true,
+	}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	dup := &factions.GameFaction{Name: "close encounters corps", Allegiance: "Empire", Government: "Patronage"}
+	if err := fcm.Create(env.ctx, dup, env.tx); !errors.Is(err, factions.ErrFactionExists) {
+		t.Fatalf("expected ErrFactionExists, got %v", err)
+	}
+}
+
+func TestFactionSearch(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	for _, f := range []*factions.GameFaction{
+		{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative", HomeSystem: "Jotun", SquadronSupported: true},
+		{Name: "Jotun Empire Party", Allegiance: "Empire", Government: "Patronage", HomeSystem: "Jotun"},
+		{Name: "Sol Workers' Party", Allegiance: "Federation", Government: "Democracy", HomeSystem: "Sol"},
+	} {
+		if err := fcm.Create(env.ctx, f, env.tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, err := fcm.Search(env.ctx, &factions.Filter{Query: "jotun"}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Name != "Close Encounters Corps" {
+		t.Errorf("unexpected search result %+v", found)
+	}
+	supported := true
+	found, err = fcm.Search(env.ctx, &factions.Filter{Supported: &supported}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || !found[0].SquadronSupported {
+		t.Errorf("unexpected supported factions %+v", found)
+	}
+	found[0].HomeSystem = ""
+	if err = fcm.Update(env.ctx, found[0], env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = fcm.Delete(env.ctx, found[0].Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fcm.FindOne(env.ctx, found[0].Id, env.tx); err == nil {
+		t.Error("deleted faction is still found")
+	}
+}
+
+func TestFactionIds(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	count := factions.MAX_LIMIT + 10
+	for i := 0; i < count; i++ {
+		f := &factions.GameFaction{Name: fmt.Sprintf("Faction %04d", i), Allegiance: "Independent", Government: "Democracy"}
+		if err := fcm.Create(env.ctx, f, env.tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := fcm.Ids(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != count {
+		t.Errorf("expected %v factions, got %v", count, len(ids))
+	}
+	last, err := fcm.FindByName(env.ctx, fmt.Sprintf("Faction %04d", count-1), env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[strings.ToLower(last.Name)] != last.Id {
+		t.Errorf("faction %v missing from ids", last.Name)
+	}
+}
+
+func TestFactionInfluence(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative"}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().Truncate(time.Hour).Add(-24 * time.Hour)
+	today := yesterday.Add(24 * time.Hour)
+	err := fcm.SaveInfluence(env.ctx, faction.Id, []*factions.InfluenceSnapshot{
+		{System: "Jotun", Tick: yesterday, Influence: 0.40},
+		{System: "Jotun", Tick: today, Influence: 0.35, ActiveStates: []string{"Election"}},
+		{System: "Sol", Tick: yesterday, Influence: 0.20},
+		{System: "Sol", Tick: today, Influence: 0.19},
+	}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// resubmission replaces numbers of the same tick, whatever the case of system
+	err = fcm.SaveInfluence(env.ctx, faction.Id, []*factions.InfluenceSnapshot{
+		{System: "SOL", Tick: today, Influence: 0.10},
+	}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a batch from the future would pass for a BGS tick, none of it is stored
+	future := time.Now().Add(30 * 24 * time.Hour)
+	err = fcm.SaveInfluence(env.ctx, faction.Id, []*factions.InfluenceSnapshot{
+		{System: "Jotun", Tick: future, Influence: 0.30},
+		{System: "Sol", Tick: future, Influence: 0.30},
+		{System: "Shinrarta Dezhra", Tick: future, Influence: 0.30},
+	}, env.tx)
+	if !errors.Is(err, factions.ErrInvalidFaction) {
+		t.Errorf("expected ErrInvalidFaction for future tick, got %v", err)
+	}
+	sol, err := fcm.InfluenceHistory(env.ctx, faction.Id, "sol", today.AddDate(0, 0, -30), env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sol) != 2 || sol[1].System != "Sol" || sol[1].Influence != 0.10 {
+		t.Errorf("unexpected history %+v", sol)
+	}
+	history, err := fcm.InfluenceHistory(env.ctx, faction.Id, "jotun", today.AddDate(0, 0, -30), env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].ActiveStates[0] != "Election" {
+		t.Errorf("unexpected history %+v", history)
+	}
+	drops, err := fcm.Drops(env.ctx, faction.Id, factions.DEFAULT_DROP, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drops) != 2 || drops[0].System != "Sol" || drops[1].System != "Jotun" {
+		t.Errorf("unexpected drops %+v", drops)
+	}
+}
+
+// EDDN snapshots carry their observation time, which differs per system.
+func TestInfluenceDropsOverTick(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative"}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	tick := &factions.Tick{Time: time.Now().Truncate(time.Second).Add(-12 * time.Hour), Systems: 3}
+	for _, s := range []*factions.InfluenceSnapshot{
+		{System: "Jotun", Tick: tick.Time.Add(-20 * time.Hour), Influence: 0.40},
+		{System: "Jotun", Tick: tick.Time.Add(-2 * time.Hour), Influence: 0.41},
+		{System: "Jotun", Tick: tick.Time.Add(37 * time.Minute), Influence: 0.36},
+		{System: "Sol", Tick: tick.Time.Add(-5 * time.Hour), Influence: 0.30},
+		{System: "Sol", Tick: tick.Time.Add(7 * time.Hour), Influence: 0.20},
+		// not seen since the tick
+		{System: "Lave", Tick: tick.Time.Add(-time.Hour), Influence: 0.50},
+		{System: "Diso", Tick: tick.Time.Add(-3 * time.Hour), Influence: 0.20},
+		{System: "Diso", Tick: tick.Time.Add(2 * time.Hour), Influence: 0.19},
+	} {
+		if _, err := fcm.RecordInfluence(env.ctx, faction.Id, s, env.tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fcm.SaveTick(env.ctx, tick, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	drops, err := fcm.Drops(env.ctx, faction.Id, factions.DEFAULT_DROP, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drops) != 2 || drops[0].System != "Sol" || drops[1].System != "Jotun" {
+		t.Fatalf("unexpected drops %+v", drops)
+	}
+	if drops[1].Previous != 0.41 || !drops[1].PreviousTick.Equal(tick.Time.Add(-2*time.Hour)) {
+		t.Errorf("drop is not measured from the latest snapshot before the tick: %+v", drops[1])
+	}
+}
+
+func TestRecordInfluence(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative"}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	// a day before now, observations up to a day later are not in the future
+	seen := time.Now().Truncate(time.Second).Add(-25 * time.Hour)
+	observations := []struct {
+		snapshot *factions.InfluenceSnapshot
+		stored   bool
+	}{
+		{&factions.InfluenceSnapshot{System: "Jotun", Tick: seen, Influence: 0.45, ActiveStates: []string{"Boom"}}, true},
+		// same numbers seen by another commander
+		{&factions.InfluenceSnapshot{System: "Jotun", Tick: seen.Add(time.Minute), Influence: 0.45, ActiveStates: []string{"Boom"}}, false},
+		{&factions.InfluenceSnapshot{System: "Jotun", Tick: seen.Add(24 * time.Hour), Influence: 0.47, ActiveStates: []string{"Boom"}}, true},
+		// relayed twice
+		{&factions.InfluenceSnapshot{System: "Jotun", Tick: seen.Add(24 * time.Hour), Influence: 0.47, ActiveStates: []string{"Boom"}}, false},
+	}
+	for i, o := range observations {
+		stored, err := fcm.RecordInfluence(env.ctx, faction.Id, o.snapshot, env.tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != o.stored {
+			t.Errorf("observation %d: stored %v, expected %v", i, stored, o.stored)
+		}
+	}
+}
+
+func TestFactionReport(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	fcm := factions.NewFactionModule(nil)
+	faction := &factions.GameFaction{Name: "Close Encounters Corps", Allegiance: "Independent", Government: "Cooperative", SquadronSupported: true}
+	if err := fcm.Create(env.ctx, faction, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	// snapshots of "today" run past the hour, keep them in the past
+	yesterday := time.Now().Truncate(time.Hour).Add(-48 * time.Hour)
+	today := yesterday.Add(24 * time.Hour)
+	err := fcm.SaveInfluence(env.ctx, faction.Id, []*factions.InfluenceSnapshot{
+		{System: "Jotun", Tick: yesterday, Influence: 0.40},
+		{System: "Sol", Tick: yesterday, Influence: 0.20},
+		{System: "Achenar", Tick: yesterday, Influence: 0.10},
+		{System: "Jotun", Tick: today, Influence: 0.42, PendingStates: []string{"Election"}},
+		{System: "Sol", Tick: today.Add(10 * time.Minute), Influence: 0.18},
+		{System: "Achenar", Tick: today.Add(30 * time.Minute), Influence: 0.11},
+	}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := fcm.InfluenceChanges(env.ctx, nil, time.Now(), env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changes right after since are still compared to the snapshots before it
+	since := yesterday.Add(time.Minute)
+	windowed, err := fcm.InfluenceChanges(env.ctx, &since, time.Now(), env.tx)
+	if err != nil || len(windowed) != 3 {
+		t.Errorf("unexpected changes since %v: %+v, %v", since, windowed, err)
+	}
+	early, err := fcm.InfluenceChanges(env.ctx, &since, today.Add(-time.Minute), env.tx)
+	if err != nil || len(early) != 0 {
+		t.Errorf("unexpected changes before %v: %+v, %v", today, early, err)
+	}
+	tick := factions.DetectTick(changes, nil)
+	if tick == nil || !tick.Time.Equal(today) {
+		t.Fatalf("unexpected tick %+v from %+v", tick, changes)
+	}
+	if err = fcm.SaveTick(env.ctx, tick, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	report, err := fcm.Report(env.ctx, faction, tick, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Systems) != 3 || len(report.ConflictsStarted) != 1 || report.Previous != nil {
+		t.Errorf("unexpected report %+v", report)
+	}
+	faction.SquadronSupported = false
+	if _, err = fcm.Report(env.ctx, faction, tick, env.tx); !errors.Is(err, factions.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package facades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/frontier"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
+)
+
+// Local stand-in for CAPI and Frontier auth, serving fixed responses by path
+type FakeCapi struct {
+	mux *http.ServeMux
+}
+
+func NewFakeCapi(responses map[string]string) *FakeCapi {
+	mux := http.NewServeMux()
+	for path, body := range responses {
+		body := body
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" && r.URL.Path != "/token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, body)
+		})
+	}
+	return &FakeCapi{mux: mux}
+}
+
+func (f *FakeCapi) Do(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	f.mux.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+const capiProfile = `{
+	"commander": {
+		"id": 1234, "name": "Jameson", "credits": 1000000, "debt": 0,
+		"currentShipId": 3, "alive": true, "docked": true,
+		"rank": {"combat": 8, "trade": 5, "explore": 3}
+	},
+	"lastSystem": {"id": 1, "name": "Shinrarta Dezhra"},
+	"lastStarport": {"id": 128666762, "name": "Jameson Memorial"},
+	"ship": {"id": 3, "name": "Anaconda", "shipName": "Cobra Killer", "shipID": "CEC-01"},
+	"squadron": {"id": 42, "name": "Close Encounters Corps", "tag": "CEC", "rank": 2}
+}`
+
+func TestFrontierFetchApi(t *testing.T) {
+	mock := MockedApi{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body: &MockedResponse{
+				Reader: strings.NewReader(`{
+					"commander": {"id": 1234, "name": "Jameson", "credits": 1000},
+					"lastSystem": {"name": "Shinrarta Dezhra"}
+				}`),
+			},
+		},
+	}
+	mod := frontier.NewFrontierModule(&mock, nil, &config.Config{})
+	token := &auth.OauthToken{AccessToken: "access", TokenType: "Bearer"}
+	acc, err := mod.FetchApi(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Cmdr != "Jameson" || acc.AccessToken != "access" {
+		t.Errorf("unexpected account %+v", acc)
+	}
+	if !strings.Contains(string(acc.CapiResponse), "Shinrarta Dezhra") {
+		t.Error("raw profile not kept")
+	}
+	mock.Response = &http.Response{
+		StatusCode: 401,
+		Body:       &MockedResponse{Reader: strings.NewReader(``)},
+	}
+	_, err = mod.FetchApi(context.Background(), token)
+	if !errors.Is(err, frontier.ErrReauthRequired) {
+		t.Errorf("expected reauth required, got %v", err)
+	}
+}
+
+func TestFrontierCommander(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	capi := NewFakeCapi(map[string]string{
+		"/profile":  capiProfile,
+		"/market":   `{"id": 128666762, "name": "Jameson Memorial", "commodities": []}`,
+		"/shipyard": `{"id": 128666762, "name": "Jameson Memorial", "ships": {}}`,
+	})
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	mod := frontier.NewFrontierModule(capi, nil, &config.Config{})
+	usr, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &auth.OauthToken{AccessToken: "access", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+	account, err := mod.FetchApi(env.ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Id, err = mod.NewAccount(env.ctx, account, usr.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mod.Sync(env.ctx, account, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	cmdr, err := mod.FindCommander(env.ctx, account.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmdr == nil || cmdr.Station != "Jameson Memorial" || cmdr.SquadronTag != "CEC" || cmdr.MarketId != 128666762 {
+		t.Fatalf("unexpected commander %+v", cmdr)
+	}
+	if cmdr.Ranks["combat"] != 8 || cmdr.Shipyard == nil {
+		t.Errorf("unexpected commander %+v", cmdr)
+	}
+}
+
+func TestFrontierRefreshToken(t *testing.T) {
+	capi := NewFakeCapi(map[string]string{
+		"/token": `{"access_token": "new-access", "token_type": "Bearer", "expires_in": 14400, "refresh_token": "new-refresh"}`,
+	})
+	mod := frontier.NewFrontierModule(capi, nil, &config.Config{FrontierClientId: "client"})
+	token, err := mod.RefreshToken(context.Background(), "old-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "new-access" || token.RefreshToken != "new-refresh" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if !token.Expiry.After(time.Now()) {
+		t.Error("token is already expired")
+	}
+}
+
+func TestFrontierNewCommander(t *testing.T) {
+	capi := NewFakeCapi(map[string]string{"/profile": capiProfile})
+	mod := frontier.NewFrontierModule(capi, nil, &config.Config{})
+	acc, err := mod.FetchApi(context.Background(), &auth.OauthToken{AccessToken: "access", TokenType: "Bearer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p items.FrontierProfile
+	if err = json.Unmarshal(acc.CapiResponse, &p); err != nil {
+		t.Fatal(err)
+	}
+	cmdr := frontier.NewCommander(&p)
+	if cmdr.ShipType != "Anaconda" || cmdr.ShipIdent != "CEC-01" || cmdr.System != "Shinrarta Dezhra" {
+		t.Errorf("unexpected ship or location %+v", cmdr)
+	}
+	if cmdr.SquadronId != 42 || cmdr.Credits != 1000000 || !cmdr.Docked {
+		t.Errorf("unexpected commander %+v", cmdr)
+	}
+}
+
+// An account failing to refresh must not hold back the others.
+func TestRefreshExpiringSkipsFailures(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	mod := frontier.NewFrontierModule(nil, nil, &config.Config{})
+	// the refresher uses its own transactions, so commit the accounts
+	tx, err := env.db.Begin(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(env.ctx)
+	usr, err := um.NewUser(env.ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// broken expires first, so it is picked first
+	for i, refresh := range []string{"broken", "good"} {
+		_, err = mod.NewAccount(env.ctx, &items.FrontierAccount{
+			Cmdr:           "CMDR " + refresh,
+			CapiResponse:   json.RawMessage(`{}`),
+			Created:        &now,
+			Updated:        &now,
+			AccessToken:    "access",
+			TokenType:      "Bearer",
+			TokenExpiresIn: now.Add(time.Duration(i+1) * time.Minute),
+			RefreshToken:   refresh,
+		}, usr.Id, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(env.ctx); err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	refresher := auth.NewTokenRefresher("frontier", "frontier_accounts", func(ctx context.Context, refresh string) (*auth.OauthToken, error) {
+		attempts++
+		if refresh == "broken" {
+			return nil, fmt.Errorf("frontier token refresh failed: 503")
+		}
+		return &auth.OauthToken{AccessToken: "new", TokenType: "Bearer", RefreshToken: "new", Expiry: time.Now().Add(4 * time.Hour)}, nil
+	}, frontier.ErrReauthRequired, env.db)
+	n, err := refresher.RefreshExpiring(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || attempts != 2 {
+		t.Errorf("expected 1 of 2 accounts refreshed, got %d of %d", n, attempts)
+	}
+	// the failed account is tried again on the next run
+	if _, err = refresher.RefreshExpiring(env.ctx); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected failed account to be retried, got %d attempts", attempts)
+	}
+}
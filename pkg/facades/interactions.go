@@ -0,0 +1,184 @@
+package facades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrBlocked = errors.New("user is blocked")
+
+// Handle discord interaction. Signature must be verified by caller.
+func (f *CoreFacade) Interact(ctx context.Context, in *discord.Interaction) (*discord.InteractionResponse, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.interact", nil)
+	defer span.End()
+	switch in.Type {
+	case discord.INTERACTION_PING:
+		return &discord.InteractionResponse{Type: discord.RESPONSE_PONG}, nil
+	case discord.INTERACTION_COMMAND:
+	default:
+		return nil, fmt.Errorf("unsupported interaction type %v", in.Type)
+	}
+	invoker := in.Invoker()
+	if in.Data == nil || invoker == nil {
+		return nil, fmt.Errorf("malformed command interaction")
+	}
+	span.AddEvent("command", trace.WithAttributes(
+		attribute.String("command", in.Data.Name),
+		attribute.String("discord.user", invoker.Id),
+	))
+	switch in.Data.Name {
+	case "whois":
+		return f.whois(ctx, invoker, in.UserOption("user"))
+	case "approve":
+		return f.approve(ctx, invoker, in.UserOption("user"))
+	case "link":
+		return f.link(ctx, invoker)
+	}
+	return discord.Reply(fmt.Sprintf("Unknown command /%s", in.Data.Name)), nil
+}
+
+// Approve pending user. Caller must be an admin who is not blocked.
+func (f *CoreFacade) ApproveUser(ctx context.Context, admin *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.approve_user", nil)
+	defer span.End()
+	if !admin.Principal.Admin || admin.Principal.State == items.StateBlocked {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	usr, err := f.users.FindOne(ctx, id, tx)
+	if err != nil {
+		return err
+	}
+	if usr.Principal.State == items.StateBlocked {
+		return ErrBlocked
+	}
+	if err = f.users.SetState(ctx, id, items.StateApproved, tx); err != nil {
+		return err
+	}
+	span.AddEvent("user approved", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("user.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Core user owning discord account, nil if not registered.
+func (f *CoreFacade) discordOwner(ctx context.Context, discordId string) (*items.User, error) {
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	return f.discord.FindUser(ctx, discordId, tx)
+}
+
+// Core user invoking a command, nil if not registered or blocked,
+// as blocked principals are refused over HTTP too.
+func (f *CoreFacade) discordCaller(ctx context.Context, invoker *discord.InteractionUser) (*items.User, error) {
+	usr, err := f.discordOwner(ctx, invoker.Id)
+	if err != nil || usr == nil || usr.Principal.State == items.StateBlocked {
+		return nil, err
+	}
+	return usr, nil
+}
+
+func (f *CoreFacade) whois(ctx context.Context, invoker *discord.InteractionUser, target string) (*discord.InteractionResponse, error) {
+	if target == "" {
+		return discord.Reply("Specify a user."), nil
+	}
+	caller, err := f.discordCaller(ctx, invoker)
+	if err != nil {
+		return nil, err
+	}
+	if caller == nil || !(caller.Principal.Admin || caller.Principal.State == items.StateApproved) {
+		return discord.Reply("Only approved members can look up users."), nil
+	}
+	usr, err := f.discordOwner(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if usr == nil {
+		return discord.Reply(fmt.Sprintf("<@%s> is not registered.", target)), nil
+	}
+	accounts, err := f.discord.FindAccounts(ctx, usr.Id, f.db)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(accounts))
+	for _, acc := range accounts {
+		names = append(names, acc.Username)
+	}
+	msg := fmt.Sprintf("<@%s> is user #%d, %s", target, usr.Id, usr.Principal.State)
+	if usr.Principal.Admin {
+		msg += ", admin"
+	}
+	msg += fmt.Sprintf(". Discord accounts: %s.", strings.Join(names, ", "))
+	return discord.Reply(msg), nil
+}
+
+func (f *CoreFacade) approve(ctx context.Context, invoker *discord.InteractionUser, target string) (*discord.InteractionResponse, error) {
+	if target == "" {
+		return discord.Reply("Specify a user."), nil
+	}
+	admin, err := f.discordCaller(ctx, invoker)
+	if err != nil {
+		return nil, err
+	}
+	if admin == nil || !admin.Principal.Admin {
+		return discord.Reply("Only admins can approve users."), nil
+	}
+	usr, err := f.discordOwner(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if usr == nil {
+		return discord.Reply(fmt.Sprintf("<@%s> is not registered.", target)), nil
+	}
+	if usr.Principal.State == items.StateApproved {
+		return discord.Reply(fmt.Sprintf("<@%s> is already approved.", target)), nil
+	}
+	err = f.ApproveUser(ctx, admin, usr.Id)
+	if errors.Is(err, ErrBlocked) {
+		return discord.Reply(fmt.Sprintf("<@%s> is blocked.", target)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return discord.Reply(fmt.Sprintf("<@%s> approved.", target)), nil
+}
+
+func (f *CoreFacade) link(ctx context.Context, invoker *discord.InteractionUser) (*discord.InteractionResponse, error) {
+	usr, err := f.discordOwner(ctx, invoker.Id)
+	if err != nil {
+		return nil, err
+	}
+	if usr != nil {
+		return discord.Reply(fmt.Sprintf("Your Discord account is linked to user #%d.", usr.Id)), nil
+	}
+	// linking needs an oauth token, so send user through cec-auth
+	u, err := url.Parse(f.config.AuthExternalUrl)
+	if err != nil {
+		return nil, err
+	}
+	u, err = u.Parse("/oauth/discord")
+	if err != nil {
+		return nil, err
+	}
+	return discord.Reply(fmt.Sprintf(
+		"Log in with Discord to register: %s\nTo link an existing account, log in to it first and connect Discord there.",
+		u.String(),
+	)), nil
+}
@@ -0,0 +1,114 @@
+package facades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
+)
+
+func TestInteractPing(t *testing.T) {
+	facade := NewCoreFacade(nil, nil, nil, nil, nil, nil, nil, nil, nil, &config.Config{})
+	var in discord.Interaction
+	if err := json.Unmarshal([]byte(`{"id": "1", "type": 1}`), &in); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := facade.Interact(context.Background(), &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != discord.RESPONSE_PONG {
+		t.Errorf("expected pong, got %+v", resp)
+	}
+}
+
+func command(invoker string, name string, target string) *discord.Interaction {
+	return &discord.Interaction{
+		Type:   discord.INTERACTION_COMMAND,
+		Member: &discord.InteractionMember{User: &discord.InteractionUser{Id: invoker}},
+		Data: &discord.InteractionData{
+			Name:    name,
+			Options: []*discord.InteractionOption{{Name: "user", Type: discord.OPTION_USER, Value: target}},
+		},
+	}
+}
+
+func TestInteractApprove(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	dm := discord.NewDiscordModule(nil, env.db, &config.Config{})
+	facade := NewCoreFacade(env.db, um, dm, nil, nil, nil, nil, nil, nil, &config.Config{})
+	// commands read through the pool, so commit the setup
+	tx, err := env.db.Begin(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(env.ctx)
+	accounts := map[string]*items.User{}
+	for _, discordId := range []string{"1001", "1002", "1003"} {
+		usr, err := um.NewUser(env.ctx, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		_, err = dm.NewAccount(env.ctx, &items.DiscordAccount{
+			DiscordId:      discordId,
+			Username:       "cmdr" + discordId,
+			Created:        &now,
+			Updated:        &now,
+			TokenExpiresIn: now.Add(time.Hour),
+		}, usr.Id, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts[discordId] = usr
+	}
+	blocked, target := accounts["1001"], accounts["1003"]
+	blocked.Principal.Admin = true
+	if err = um.Save(env.ctx, blocked, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = um.SetState(env.ctx, blocked.Id, items.StateBlocked, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(env.ctx); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		invoker string
+		name    string
+		reply   string
+	}{
+		{"1001", "approve", "Only admins can approve users."},
+		{"1002", "approve", "Only admins can approve users."},
+		{"1001", "whois", "Only approved members can look up users."},
+	}
+	for _, c := range cases {
+		resp, err := facade.Interact(env.ctx, command(c.invoker, c.name, "1003"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data == nil || resp.Data.Content != c.reply {
+			t.Errorf("/%s by %s: unexpected reply %+v", c.name, c.invoker, resp.Data)
+		}
+	}
+	blocked.Principal.State = items.StateBlocked
+	if err = facade.ApproveUser(env.ctx, blocked, target.Id); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden approving as blocked admin, got %v", err)
+	}
+	usr, err := um.FindOne(env.ctx, target.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.Principal.State != items.StatePending {
+		t.Errorf("target was changed to %s", usr.Principal.State)
+	}
+}
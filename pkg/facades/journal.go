@@ -0,0 +1,50 @@
+package facades
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store journal events uploaded by user for one of their commanders.
+// cmdr may be empty when the user has only one frontier account.
+func (f *CoreFacade) IngestJournal(ctx context.Context, usr *items.User, cmdr string, r io.Reader) (*items.JournalResult, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.ingest_journal", nil)
+	defer span.End()
+	accounts, err := f.frontier.FindAccounts(ctx, usr.Id, f.db)
+	if err != nil {
+		return nil, err
+	}
+	var account *items.FrontierAccount
+	for _, acc := range accounts {
+		if cmdr == "" && len(accounts) == 1 || strings.EqualFold(acc.Cmdr, cmdr) {
+			account = acc
+		}
+	}
+	if account == nil {
+		if cmdr == "" && len(accounts) > 1 {
+			return nil, journal.ErrCmdrRequired
+		}
+		return nil, journal.ErrNoCommander
+	}
+	span.AddEvent("commander found", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.Int64("frontier.id", int64(account.Id)),
+	))
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	result, err := f.journal.Ingest(ctx, account.Id, account.Cmdr, r, tx)
+	if err != nil {
+		return nil, err
+	}
+	return result, tx.Commit(ctx)
+}
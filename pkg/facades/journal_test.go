@@ -0,0 +1,52 @@
+package facades
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/frontier"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/journal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
+)
+
+func TestJournalIngest(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	fm := frontier.NewFrontierModule(NewFakeCapi(map[string]string{"/profile": capiProfile}), nil, &config.Config{})
+	jm := journal.NewJournalModule()
+	usr, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := fm.FetchApi(env.ctx, &auth.OauthToken{AccessToken: "access", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Id, err = fm.NewAccount(env.ctx, account, usr.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := strings.Join([]string{
+		`{"timestamp": "2022-01-02T03:04:05Z", "event": "Commander", "FID": "F1234", "Name": "Jameson"}`,
+		`{"timestamp": "2022-01-02T03:04:06Z", "event": "Location", "StarSystem": "Sol", "SystemAddress": 10477373803, "StarPos": [0, 0, 0]}`,
+		``,
+		`{"timestamp": "2022-01-02T03:04:06Z", "event": "Location", "StarSystem": "Sol", "SystemAddress": 10477373803, "StarPos": [0, 0, 0]}`,
+		`{"timestamp": "2022-01-02T03:04:07Z", "event": "Commander", "FID": "F5678", "Name": "Someone Else"}`,
+		`{"timestamp": "2022-01-02T03:04:08Z", "event": "FSDJump", "StarSystem": "Achenar"}`,
+	}, "\n")
+	result, err := jm.Ingest(env.ctx, account.Id, account.Cmdr, strings.NewReader(batch), env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Accepted != 2 || result.Duplicates != 1 || len(result.Rejected) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Rejected[0].Line != 5 || result.Rejected[1].Line != 6 {
+		t.Errorf("unexpected rejections %+v %+v", result.Rejected[0], result.Rejected[1])
+	}
+}
@@ -0,0 +1,188 @@
+package facades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (f *CoreFacade) Ops(ctx context.Context, filter *ops.Filter) ([]*ops.Op, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.ops", nil)
+	defer span.End()
+	return f.ops.Search(ctx, filter, f.db)
+}
+
+// Op with members signed up for it.
+func (f *CoreFacade) Op(ctx context.Context, id uint64) (*ops.Op, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.op", nil)
+	defer span.End()
+	op, err := f.ops.FindOne(ctx, id, f.db)
+	if err != nil {
+		return nil, err
+	}
+	if op.Signups, err = f.ops.Signups(ctx, id, f.db); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// Upcoming ops usr is signed up for.
+func (f *CoreFacade) UserOps(ctx context.Context, usr *items.User) ([]*ops.Op, error) {
+	ctx, span := tracer.NewSpan(ctx, "core.user_ops", nil)
+	defer span.End()
+	return f.ops.UserOps(ctx, usr.Id, time.Now(), f.db)
+}
+
+// Target faction of op has to be registered.
+func (f *CoreFacade) checkOpFaction(ctx context.Context, op *ops.Op, tx pgx.Tx) error {
+	if op.FactionId == nil {
+		return nil
+	}
+	_, err := f.factions.FindOne(ctx, *op.FactionId, tx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: unknown faction %d", ops.ErrInvalidOp, *op.FactionId)
+	}
+	return err
+}
+
+func (f *CoreFacade) CreateOp(ctx context.Context, admin *items.User, op *ops.Op) error {
+	ctx, span := tracer.NewSpan(ctx, "core.create_op", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.checkOpFaction(ctx, op, tx); err != nil {
+		return err
+	}
+	op.CreatedBy = &admin.Id
+	if err = f.ops.Create(ctx, op, tx); err != nil {
+		return err
+	}
+	span.AddEvent("op created", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("op.id", int64(op.Id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) UpdateOp(ctx context.Context, admin *items.User, op *ops.Op) error {
+	ctx, span := tracer.NewSpan(ctx, "core.update_op", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.checkOpFaction(ctx, op, tx); err != nil {
+		return err
+	}
+	if err = f.ops.Update(ctx, op, tx); err != nil {
+		return err
+	}
+	span.AddEvent("op updated", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("op.id", int64(op.Id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) CancelOp(ctx context.Context, admin *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.cancel_op", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.ops.Cancel(ctx, id, tx); err != nil {
+		return err
+	}
+	span.AddEvent("op cancelled", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("op.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Sign usr up for op, approved members only.
+func (f *CoreFacade) SignUp(ctx context.Context, usr *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.op_signup", nil)
+	defer span.End()
+	if usr.Principal.State != items.StateApproved {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.ops.SignUp(ctx, id, usr.Id, tx); err != nil {
+		return err
+	}
+	span.AddEvent("signed up", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.Int64("op.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+func (f *CoreFacade) Withdraw(ctx context.Context, usr *items.User, id uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.op_withdraw", nil)
+	defer span.End()
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = f.ops.Withdraw(ctx, id, usr.Id, tx); err != nil {
+		return err
+	}
+	span.AddEvent("withdrawn", trace.WithAttributes(
+		attribute.Int64("user.id", int64(usr.Id)),
+		attribute.Int64("op.id", int64(id)),
+	))
+	return tx.Commit(ctx)
+}
+
+// Complete op with report of admin, attended are ids of members who took part.
+func (f *CoreFacade) CompleteOp(ctx context.Context, admin *items.User, id uint64, report *ops.Report, attended []uint64) error {
+	ctx, span := tracer.NewSpan(ctx, "core.complete_op", nil)
+	defer span.End()
+	if !admin.Principal.Admin {
+		return ErrForbidden
+	}
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	report.ReportedBy = &admin.Id
+	if err = f.ops.Complete(ctx, id, report, attended, tx); err != nil {
+		return err
+	}
+	span.AddEvent("op completed", trace.WithAttributes(
+		attribute.Int64("admin.user.id", int64(admin.Id)),
+		attribute.Int64("op.id", int64(id)),
+		attribute.Int("op.attended", len(attended)),
+	))
+	return tx.Commit(ctx)
+}
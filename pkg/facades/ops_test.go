@@ -0,0 +1,244 @@
+package facades
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/ops"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestOpSignups(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	om := ops.NewOpsModule(nil, nil, &config.Config{})
+	officer, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := time.Now().Add(time.Hour).Truncate(time.Second)
+	op := &ops.Op{
+		Title:     "Laser mining run",
+		Kind:      "mining",
+		System:    "Jotun",
+		Objective: "Fill the carrier with platinum",
+		Starts:    starts,
+		Ends:      starts.Add(2 * time.Hour),
+		Capacity:  1,
+		CreatedBy: &officer.Id,
+	}
+	if err = om.Create(env.ctx, op, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = om.SignUp(env.ctx, op.Id, first.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	// signing up twice is fine
+	if err = om.SignUp(env.ctx, op.Id, first.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = om.SignUp(env.ctx, op.Id, second.Id, env.tx); !errors.Is(err, ops.ErrOpFull) {
+		t.Errorf("expected ErrOpFull, got %v", err)
+	}
+	if err = om.Withdraw(env.ctx, op.Id, second.Id, env.tx); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected ErrNoRows withdrawing without signup, got %v", err)
+	}
+	if err = om.Withdraw(env.ctx, op.Id, first.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	op.Capacity = 2
+	if err = om.Update(env.ctx, op, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	for _, usr := range []uint64{first.Id, second.Id} {
+		if err = om.SignUp(env.ctx, op.Id, usr, env.tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.Capacity = 1
+	if err = om.Update(env.ctx, op, env.tx); !errors.Is(err, ops.ErrOpFull) {
+		t.Errorf("expected ErrOpFull lowering capacity below signups, got %v", err)
+	}
+	upcoming, err := om.UserOps(env.ctx, second.Id, time.Now(), env.tx)
+	if err != nil || len(upcoming) != 1 || upcoming[0].SignedUp != 2 {
+		t.Errorf("unexpected ops of user %v, %v", upcoming, err)
+	}
+	report := &ops.Report{Outcome: "Success", Summary: "Carrier is full", ReportedBy: &officer.Id}
+	if err = om.Complete(env.ctx, op.Id, report, []uint64{officer.Id}, env.tx); !errors.Is(err, ops.ErrInvalidOp) {
+		t.Errorf("expected ErrInvalidOp for attendee without signup, got %v", err)
+	}
+	if err = om.Complete(env.ctx, op.Id, report, []uint64{first.Id}, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = om.SignUp(env.ctx, op.Id, officer.Id, env.tx); !errors.Is(err, ops.ErrOpClosed) {
+		t.Errorf("expected ErrOpClosed for completed op, got %v", err)
+	}
+	stored, err := om.FindOne(env.ctx, op.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != ops.STATUS_COMPLETED || stored.Report == nil || stored.Report.Outcome != "success" || stored.Report.Completed == nil {
+		t.Errorf("unexpected completed op %+v", stored)
+	}
+	signups, err := om.Signups(env.ctx, op.Id, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range signups {
+		if s.Attended == nil || *s.Attended != (s.UserId == first.Id) {
+			t.Errorf("unexpected attendance %+v", s)
+		}
+	}
+}
+
+// Concurrent signups of several members must not overrun capacity.
+func TestConcurrentSignups(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	om := ops.NewOpsModule(nil, nil, &config.Config{})
+	// signups run in their own transactions, so commit the setup
+	tx, err := env.db.Begin(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(env.ctx)
+	members := make([]uint64, 8)
+	for i := range members {
+		usr, err := um.NewUser(env.ctx, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[i] = usr.Id
+	}
+	starts := time.Now().Add(time.Hour)
+	op := &ops.Op{
+		Title:     "Wing patrol",
+		Kind:      "combat",
+		Objective: "Hold the nav beacon",
+		Starts:    starts,
+		Ends:      starts.Add(time.Hour),
+		Capacity:  3,
+	}
+	if err = om.Create(env.ctx, op, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(env.ctx); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, len(members))
+	for _, id := range members {
+		go func(id uint64) {
+			tx, err := env.db.Begin(env.ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer tx.Rollback(env.ctx)
+			if err = om.SignUp(env.ctx, op.Id, id, tx); err != nil {
+				errs <- err
+				return
+			}
+			errs <- tx.Commit(env.ctx)
+		}(id)
+	}
+	full := 0
+	for range members {
+		err := <-errs
+		if errors.Is(err, ops.ErrOpFull) {
+			full++
+		} else if err != nil {
+			t.Error(err)
+		}
+	}
+	stored, err := om.FindOne(env.ctx, op.Id, env.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SignedUp != op.Capacity || full != len(members)-op.Capacity {
+		t.Errorf("expected %d signups, got %d with %d rejected", op.Capacity, stored.SignedUp, full)
+	}
+}
+
+func TestMergeOpSignups(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	um := users.NewUserModule(principal.NewPrincipalModule())
+	om := ops.NewOpsModule(nil, nil, &config.Config{})
+	target, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := um.NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := time.Now().Add(time.Hour).Truncate(time.Second)
+	var opIds []uint64
+	for _, title := range []string{"Patrol", "Escort"} {
+		op := &ops.Op{
+			Title:     title,
+			Kind:      "combat",
+			Objective: "Keep the lanes clear",
+			Starts:    starts,
+			Ends:      starts.Add(time.Hour),
+			CreatedBy: &source.Id,
+		}
+		if err = om.Create(env.ctx, op, env.tx); err != nil {
+			t.Fatal(err)
+		}
+		opIds = append(opIds, op.Id)
+	}
+	if err = om.SignUp(env.ctx, opIds[0], target.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range opIds {
+		if err = om.SignUp(env.ctx, id, source.Id, env.tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = env.tx.Exec(env.ctx, `UPDATE op_signups SET attended = true WHERE user_id = $1`, source.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = um.Merge(env.ctx, target.Id, target.Id, env.tx); !errors.Is(err, users.ErrSelfMerge) {
+		t.Errorf("expected ErrSelfMerge, got %v", err)
+	}
+	if err = um.Merge(env.ctx, target.Id, source.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	var signups, attended int
+	err = env.tx.QueryRow(env.ctx, `
+	SELECT count(*), count(*) FILTER (WHERE attended) FROM op_signups WHERE user_id = $1
+	`, target.Id).Scan(&signups, &attended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signups != 2 || attended != 2 {
+		t.Errorf("expected 2 attended signups of target, got %v of %v", attended, signups)
+	}
+	var left int
+	err = env.tx.QueryRow(env.ctx, `
+	SELECT (SELECT count(*) FROM op_signups WHERE user_id = $1) +
+		(SELECT count(*) FROM ops WHERE created_by = $1)
+	`, source.Id).Scan(&left)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%v rows still reference source user", left)
+	}
+}
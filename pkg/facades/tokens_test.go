@@ -0,0 +1,161 @@
+package facades
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth/tokens"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/principal"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/users"
+)
+
+func tokenModule(keys ...string) *tokens.TokenModule {
+	cfg := &config.Config{
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	for _, id := range keys {
+		cfg.TokenKeys = append(cfg.TokenKeys, config.TokenKey{Id: id, Secret: "secret-" + id})
+	}
+	return tokens.NewTokenModule(cfg)
+}
+
+func (env *Environment) keyId(table string, id uint64) string {
+	var keyId string
+	err := env.tx.QueryRow(env.ctx, `SELECT key_id FROM `+table+` WHERE id = $1`, id).Scan(&keyId)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	return keyId
+}
+
+func TestRehashRetiredKey(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	usr, err := users.NewUserModule(principal.NewPrincipalModule()).NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := tokenModule("old")
+	key, err := old.NewApiKey(env.ctx, usr.Principal.Id, "bot", []string{tokens.SCOPE_USERS_READ}, nil, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := old.NewToken(env.ctx, usr.Principal, &items.ClientInfo{}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := tokenModule("new", "old")
+	if _, err = rotated.Resolve(env.ctx, env.tx, key.Key); err != nil {
+		t.Fatal(err)
+	}
+	if keyId := env.keyId("api_keys", key.Id); keyId != "new" {
+		t.Errorf("api key is still hashed by %s", keyId)
+	}
+	var refreshId uint64
+	err = env.tx.QueryRow(env.ctx, `SELECT id FROM refresh_tokens WHERE principal_id = $1`, usr.Principal.Id).Scan(&refreshId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = rotated.Refresh(env.ctx, pair.RefreshToken, &items.ClientInfo{}, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if keyId := env.keyId("refresh_tokens", refreshId); keyId != "new" {
+		t.Errorf("refresh token is still hashed by %s", keyId)
+	}
+	// with the old key dropped, the used refresh token is still recognised as reused
+	current := tokenModule("new")
+	if _, err = current.Resolve(env.ctx, env.tx, key.Key); err != nil {
+		t.Errorf("api key not found by current key: %v", err)
+	}
+	if _, _, err = current.Refresh(env.ctx, pair.RefreshToken, &items.ClientInfo{}, env.tx); !errors.Is(err, tokens.ErrTokenReused) {
+		t.Errorf("expected reuse to be detected, got %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	usr, err := users.NewUserModule(principal.NewPrincipalModule()).NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := tokenModule("current")
+	client := &items.ClientInfo{IP: "127.0.0.1", UserAgent: "test"}
+	first, err := mod.NewToken(env.ctx, usr.Principal, client, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, second, err := mod.Refresh(env.ctx, first.RefreshToken, client, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != usr.Principal.Id {
+		t.Errorf("refreshed token of principal %v, expected %v", pid, usr.Principal.Id)
+	}
+	if second.AccessToken == first.AccessToken || second.RefreshToken == first.RefreshToken {
+		t.Error("refresh did not rotate the token pair")
+	}
+	if _, err = mod.Resolve(env.ctx, env.tx, first.AccessToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("superseded access token still valid: %v", err)
+	}
+	if _, err = mod.Resolve(env.ctx, env.tx, second.AccessToken); err != nil {
+		t.Errorf("rotated access token is invalid: %v", err)
+	}
+	// presenting the used refresh token again revokes the whole family
+	if _, _, err = mod.Refresh(env.ctx, first.RefreshToken, client, env.tx); !errors.Is(err, tokens.ErrTokenReused) {
+		t.Errorf("expected ErrTokenReused, got %v", err)
+	}
+	if _, err = mod.Resolve(env.ctx, env.tx, second.AccessToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("access token of reused family still valid: %v", err)
+	}
+	if _, _, err = mod.Refresh(env.ctx, second.RefreshToken, client, env.tx); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("refresh token of reused family still valid: %v", err)
+	}
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	env := NewEnvironment(t)
+	defer env.Drop()
+	usr, err := users.NewUserModule(principal.NewPrincipalModule()).NewUser(env.ctx, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := tokenModule("current")
+	if _, err = mod.NewApiKey(env.ctx, usr.Principal.Id, "bad", []string{"admin"}, nil, env.tx); !errors.Is(err, tokens.ErrUnknownScope) {
+		t.Errorf("expected ErrUnknownScope, got %v", err)
+	}
+	key, err := mod.NewApiKey(env.ctx, usr.Principal.Id, "journal", []string{tokens.SCOPE_JOURNAL_WRITE}, nil, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, err := mod.Authorize(env.ctx, env.tx, key.Key, tokens.SCOPE_JOURNAL_WRITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.ApiKeyId != key.Id || grant.PrincipalId != usr.Principal.Id {
+		t.Errorf("unexpected grant %+v", grant)
+	}
+	for _, scope := range []string{tokens.SCOPE_USERS_READ, tokens.SCOPE_USERS_WRITE, tokens.SCOPE_FACTIONS_WRITE} {
+		if _, err = mod.Authorize(env.ctx, env.tx, key.Key, scope); !errors.Is(err, tokens.ErrScope) {
+			t.Errorf("expected ErrScope for %s, got %v", scope, err)
+		}
+	}
+	// login tokens are not limited by scopes
+	pair, err := mod.NewToken(env.ctx, usr.Principal, &items.ClientInfo{}, env.tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mod.Authorize(env.ctx, env.tx, pair.AccessToken, tokens.SCOPE_USERS_WRITE); err != nil {
+		t.Errorf("login token denied: %v", err)
+	}
+	if err = mod.RevokeApiKey(env.ctx, usr.Principal.Id, key.Id, env.tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mod.Authorize(env.ctx, env.tx, key.Key, tokens.SCOPE_JOURNAL_WRITE); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("revoked api key still valid: %v", err)
+	}
+}
@@ -0,0 +1,473 @@
+package factions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrInvalidConflict = errors.New("invalid conflict")
+
+// Conflict statuses. Journal reports an empty status for
+// conflicts which are over.
+const (
+	CONFLICT_PENDING = "pending"
+	CONFLICT_ACTIVE  = "active"
+	CONFLICT_ENDED   = "ended"
+)
+
+// Conflicts are best of 7 days
+const (
+	CONFLICT_DAYS_TO_WIN = 4
+	CONFLICT_MAX_DAYS    = 7
+)
+
+// Longest faction name or stake stored
+const MAX_NAME = 128
+
+// Outcome of a conflict which ended with equal days
+const OUTCOME_DRAW = "draw"
+
+var WAR_TYPES = []string{"war", "civilwar", "election"}
+
+type ConflictSide struct {
+	// registered faction, nil for unknown ones
+	FactionId *uint64 `json:"faction_id,omitempty"`
+	Name      string  `json:"name"`
+	// asset won by the other side
+	Stake   string `json:"stake,omitempty"`
+	WonDays int    `json:"won_days"`
+	// faction is supported by our squadron
+	Supported bool `json:"supported"`
+}
+
+// War or election between two factions of a system
+type Conflict struct {
+	Id       uint64       `json:"id"`
+	System   string       `json:"system"`
+	WarType  string       `json:"war_type"`
+	Status   string       `json:"status"`
+	Faction1 ConflictSide `json:"faction1"`
+	Faction2 ConflictSide `json:"faction2"`
+	// days until either side can win
+	DaysLeft int `json:"days_left"`
+	// name of the winner or draw, empty until the conflict ends
+	Outcome string `json:"outcome,omitempty"`
+	// set by an admin, snapshots do not change it
+	Manual  bool       `json:"manual"`
+	Started time.Time  `json:"started"`
+	Updated time.Time  `json:"updated"`
+	Ended   *time.Time `json:"ended,omitempty"`
+}
+
+// Conflict as reported by a system snapshot
+type ConflictObservation struct {
+	WarType string
+	// pending, active or empty when over
+	Status   string
+	Faction1 ConflictSide
+	Faction2 ConflictSide
+}
+
+func (c *Conflict) daysLeft() int {
+	days := c.Faction1.WonDays
+	if c.Faction2.WonDays > days {
+		days = c.Faction2.WonDays
+	}
+	if left := CONFLICT_DAYS_TO_WIN - days; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Days won by the supported side over its opponent, faction1 is
+// taken when both or neither are supported.
+func (c *Conflict) Margin() int {
+	if !c.Faction1.Supported && c.Faction2.Supported {
+		return c.Faction2.WonDays - c.Faction1.WonDays
+	}
+	return c.Faction1.WonDays - c.Faction2.WonDays
+}
+
+func (c *Conflict) outcome() string {
+	switch {
+	case c.Faction1.WonDays > c.Faction2.WonDays:
+		return c.Faction1.Name
+	case c.Faction2.WonDays > c.Faction1.WonDays:
+		return c.Faction2.Name
+	}
+	return OUTCOME_DRAW
+}
+
+func (c *Conflict) end(at time.Time) {
+	c.Status = CONFLICT_ENDED
+	if c.Outcome == "" {
+		c.Outcome = c.outcome()
+	}
+	if c.Ended == nil {
+		c.Ended = &at
+	}
+}
+
+// Most urgent first: active conflicts before pending ones, then
+// the ones closest to being decided, then the ones where the
+// supported side is further behind.
+func SortByUrgency(conflicts []*Conflict) {
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if (a.Status == CONFLICT_ACTIVE) != (b.Status == CONFLICT_ACTIVE) {
+			return a.Status == CONFLICT_ACTIVE
+		}
+		if a.DaysLeft != b.DaysLeft {
+			return a.DaysLeft < b.DaysLeft
+		}
+		return a.Margin() < b.Margin()
+	})
+}
+
+func validDays(days int) bool {
+	return days >= 0 && days <= CONFLICT_MAX_DAYS
+}
+
+func ValidateObservation(o *ConflictObservation) error {
+	warType, ok := oneOf(o.WarType, WAR_TYPES)
+	if !ok {
+		return fmt.Errorf("%w: unknown war type %s", ErrInvalidConflict, o.WarType)
+	}
+	o.WarType = warType
+	o.Status = strings.ToLower(o.Status)
+	if o.Status != "" && o.Status != CONFLICT_PENDING && o.Status != CONFLICT_ACTIVE {
+		return fmt.Errorf("%w: unknown status %s", ErrInvalidConflict, o.Status)
+	}
+	for _, side := range []*ConflictSide{&o.Faction1, &o.Faction2} {
+		side.Name = strings.TrimSpace(side.Name)
+		if side.Name == "" {
+			return fmt.Errorf("%w: faction name is required", ErrInvalidConflict)
+		}
+		if utf8.RuneCountInString(side.Name) > MAX_NAME || utf8.RuneCountInString(side.Stake) > MAX_NAME {
+			return fmt.Errorf("%w: faction name or stake is longer than %d characters", ErrInvalidConflict, MAX_NAME)
+		}
+		if !validDays(side.WonDays) {
+			return fmt.Errorf("%w: won days must be between 0 and %d", ErrInvalidConflict, CONFLICT_MAX_DAYS)
+		}
+	}
+	if strings.EqualFold(o.Faction1.Name, o.Faction2.Name) {
+		return fmt.Errorf("%w: faction cannot fight itself", ErrInvalidConflict)
+	}
+	return nil
+}
+
+// Observation is about conflict c, with sides swapped when needed.
+func (o *ConflictObservation) matches(c *Conflict) (bool, bool) {
+	a, b := strings.ToLower(o.Faction1.Name), strings.ToLower(o.Faction2.Name)
+	x, y := strings.ToLower(c.Faction1.Name), strings.ToLower(c.Faction2.Name)
+	if a == x && b == y {
+		return true, false
+	}
+	return a == y && b == x, true
+}
+
+const conflictColumns = `c.id, c.system, c.war_type, c.status,
+	c.faction1_id, c.faction1_name, COALESCE(c.faction1_stake, ''), c.faction1_days,
+	COALESCE(f1.squadron_supported, false),
+	c.faction2_id, c.faction2_name, COALESCE(c.faction2_stake, ''), c.faction2_days,
+	COALESCE(f2.squadron_supported, false),
+	COALESCE(c.outcome, ''), c.manual, c.started, c.updated, c.ended`
+
+const conflictJoins = `faction_conflicts c
+	LEFT JOIN game_factions f1 ON f1.id = c.faction1_id
+	LEFT JOIN game_factions f2 ON f2.id = c.faction2_id`
+
+func scanConflict(row pgx.Row) (*Conflict, error) {
+	c := &Conflict{}
+	err := row.Scan(
+		&c.Id,
+		&c.System,
+		&c.WarType,
+		&c.Status,
+		&c.Faction1.FactionId,
+		&c.Faction1.Name,
+		&c.Faction1.Stake,
+		&c.Faction1.WonDays,
+		&c.Faction1.Supported,
+		&c.Faction2.FactionId,
+		&c.Faction2.Name,
+		&c.Faction2.Stake,
+		&c.Faction2.WonDays,
+		&c.Faction2.Supported,
+		&c.Outcome,
+		&c.Manual,
+		&c.Started,
+		&c.Updated,
+		&c.Ended,
+	)
+	c.DaysLeft = c.daysLeft()
+	return c, err
+}
+
+func collectConflicts(rows pgx.Rows, err error) ([]*Conflict, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]*Conflict, 0)
+	for rows.Next() {
+		c, err := scanConflict(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *FactionModule) FindConflict(ctx context.Context, id uint64, db api.DbConn) (*Conflict, error) {
+	return scanConflict(db.QueryRow(ctx, `SELECT `+conflictColumns+` FROM `+conflictJoins+` WHERE c.id = $1`, id))
+}
+
+// Pending and active conflicts, of faction when factionId is not 0,
+// most urgent first.
+func (m *FactionModule) ActiveConflicts(ctx context.Context, factionId uint64, db api.DbConn) ([]*Conflict, error) {
+	conflicts, err := collectConflicts(db.Query(ctx, `
+	SELECT `+conflictColumns+` FROM `+conflictJoins+`
+	WHERE c.status <> 'ended'
+	AND ($1 = 0 OR c.faction1_id = $1 OR c.faction2_id = $1)
+	`, factionId))
+	if err != nil {
+		return nil, err
+	}
+	SortByUrgency(conflicts)
+	return conflicts, nil
+}
+
+// Every conflict of faction, newest first.
+func (m *FactionModule) FactionConflicts(ctx context.Context, factionId uint64, db api.DbConn) ([]*Conflict, error) {
+	return collectConflicts(db.Query(ctx, `
+	SELECT `+conflictColumns+` FROM `+conflictJoins+`
+	WHERE c.faction1_id = $1 OR c.faction2_id = $1
+	ORDER BY c.started DESC, c.id DESC
+	`, factionId))
+}
+
+func (m *FactionModule) saveConflict(ctx context.Context, c *Conflict, tx pgx.Tx) error {
+	c.DaysLeft = c.daysLeft()
+	if c.Id == 0 {
+		return tx.QueryRow(ctx, `
+		INSERT INTO faction_conflicts (
+			system, war_type, status,
+			faction1_id, faction1_name, faction1_stake, faction1_days,
+			faction2_id, faction2_name, faction2_stake, faction2_days,
+			outcome, manual, started, updated, ended
+		) VALUES (
+			$1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, NULLIF($10, ''), $11,
+			NULLIF($12, ''), $13, $14, $15, $16
+		)
+		RETURNING id
+		`, c.System, c.WarType, c.Status,
+			c.Faction1.FactionId, c.Faction1.Name, c.Faction1.Stake, c.Faction1.WonDays,
+			c.Faction2.FactionId, c.Faction2.Name, c.Faction2.Stake, c.Faction2.WonDays,
+			c.Outcome, c.Manual, c.Started, c.Updated, c.Ended,
+		).Scan(&c.Id)
+	}
+	_, err := tx.Exec(ctx, `
+	UPDATE faction_conflicts SET
+		status = $2,
+		faction1_stake = NULLIF($3, ''),
+		faction1_days = $4,
+		faction2_stake = NULLIF($5, ''),
+		faction2_days = $6,
+		outcome = NULLIF($7, ''),
+		manual = $8,
+		updated = $9,
+		ended = $10
+	WHERE id = $1
+	`, c.Id, c.Status, c.Faction1.Stake, c.Faction1.WonDays,
+		c.Faction2.Stake, c.Faction2.WonDays, c.Outcome, c.Manual, c.Updated, c.Ended)
+	return err
+}
+
+type registered struct {
+	id        uint64
+	name      string
+	supported bool
+}
+
+func (m *FactionModule) registeredByName(ctx context.Context, names []string, tx pgx.Tx) (map[string]registered, error) {
+	out := make(map[string]registered)
+	rows, err := tx.Query(ctx, `
+	SELECT id, name, squadron_supported FROM game_factions WHERE lower(name) = ANY($1)
+	`, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r registered
+		if err = rows.Scan(&r.id, &r.name, &r.supported); err != nil {
+			return nil, err
+		}
+		out[strings.ToLower(r.name)] = r
+	}
+	return out, rows.Err()
+}
+
+// Update conflicts of system from its snapshot observed at given time.
+// New conflicts are tracked when a supported faction takes part, open
+// conflicts missing from the snapshot or reported as over are ended.
+// Conflicts set by admins, and ones updated after the snapshot was observed,
+// are left alone. Returns number of changed conflicts.
+func (m *FactionModule) UpdateConflicts(ctx context.Context, system string, observed time.Time, observations []*ConflictObservation, tx pgx.Tx) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, "factions.update_conflicts", nil)
+	defer span.End()
+	system = strings.TrimSpace(system)
+	if system == "" {
+		return 0, fmt.Errorf("%w: system is required", ErrInvalidConflict)
+	}
+	if utf8.RuneCountInString(system) > MAX_SYSTEM {
+		return 0, fmt.Errorf("%w: system is longer than %d characters", ErrInvalidConflict, MAX_SYSTEM)
+	}
+	// a future snapshot would shadow every later one
+	if observed.After(time.Now().Add(MAX_CLOCK_SKEW)) {
+		return 0, fmt.Errorf("%w: observed is in the future", ErrInvalidConflict)
+	}
+	names := make([]string, 0, len(observations)*2)
+	for i, o := range observations {
+		if err := ValidateObservation(o); err != nil {
+			return 0, fmt.Errorf("conflict %d: %w", i, err)
+		}
+		names = append(names, strings.ToLower(o.Faction1.Name), strings.ToLower(o.Faction2.Name))
+	}
+	open, err := collectConflicts(tx.Query(ctx, `
+	SELECT `+conflictColumns+` FROM `+conflictJoins+`
+	WHERE lower(c.system) = lower($1) AND c.status <> 'ended'
+	FOR UPDATE OF c
+	`, system))
+	if err != nil {
+		return 0, err
+	}
+	factions, err := m.registeredByName(ctx, names, tx)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	seen := make(map[uint64]bool)
+	for _, o := range observations {
+		var c *Conflict
+		swapped := false
+		for _, candidate := range open {
+			if ok, swap := o.matches(candidate); ok {
+				c, swapped = candidate, swap
+				break
+			}
+		}
+		if c != nil {
+			seen[c.Id] = true
+			if c.Manual || !observed.After(c.Updated) {
+				continue
+			}
+		} else {
+			f1, f2 := factions[strings.ToLower(o.Faction1.Name)], factions[strings.ToLower(o.Faction2.Name)]
+			if o.Status == "" || !f1.supported && !f2.supported {
+				continue
+			}
+			c = &Conflict{
+				System:   system,
+				WarType:  o.WarType,
+				Faction1: ConflictSide{Name: o.Faction1.Name, Supported: f1.supported},
+				Faction2: ConflictSide{Name: o.Faction2.Name, Supported: f2.supported},
+				Started:  observed,
+			}
+			if f1.id != 0 {
+				c.Faction1.FactionId, c.Faction1.Name = &f1.id, f1.name
+			}
+			if f2.id != 0 {
+				c.Faction2.FactionId, c.Faction2.Name = &f2.id, f2.name
+			}
+		}
+		side1, side2 := o.Faction1, o.Faction2
+		if swapped {
+			side1, side2 = side2, side1
+		}
+		c.Faction1.Stake, c.Faction1.WonDays = side1.Stake, side1.WonDays
+		c.Faction2.Stake, c.Faction2.WonDays = side2.Stake, side2.WonDays
+		c.Updated = observed
+		if o.Status == "" {
+			c.end(observed)
+		} else {
+			c.Status = o.Status
+		}
+		if err = m.saveConflict(ctx, c, tx); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	for _, c := range open {
+		// snapshots relayed late do not end conflicts seen since
+		if seen[c.Id] || c.Manual || !observed.After(c.Updated) {
+			continue
+		}
+		c.Updated = observed
+		c.end(observed)
+		if err = m.saveConflict(ctx, c, tx); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	span.SetAttributes(
+		attribute.String("conflicts.system", system),
+		attribute.Int("conflicts.changed", changed),
+	)
+	return changed, nil
+}
+
+// Replace status, days, stakes and outcome of conflict c.Id set by
+// an admin. Conflict stays as set until Manual is cleared.
+func (m *FactionModule) OverrideConflict(ctx context.Context, c *Conflict, tx pgx.Tx) error {
+	stored, err := scanConflict(tx.QueryRow(ctx, `
+	SELECT `+conflictColumns+` FROM `+conflictJoins+` WHERE c.id = $1 FOR UPDATE OF c
+	`, c.Id))
+	if err != nil {
+		return err
+	}
+	if c.Status != CONFLICT_PENDING && c.Status != CONFLICT_ACTIVE && c.Status != CONFLICT_ENDED {
+		return fmt.Errorf("%w: unknown status %s", ErrInvalidConflict, c.Status)
+	}
+	if !validDays(c.Faction1.WonDays) || !validDays(c.Faction2.WonDays) {
+		return fmt.Errorf("%w: won days must be between 0 and %d", ErrInvalidConflict, CONFLICT_MAX_DAYS)
+	}
+	if utf8.RuneCountInString(c.Faction1.Stake) > MAX_NAME || utf8.RuneCountInString(c.Faction2.Stake) > MAX_NAME {
+		return fmt.Errorf("%w: stake is longer than %d characters", ErrInvalidConflict, MAX_NAME)
+	}
+	if c.Outcome != "" && c.Outcome != OUTCOME_DRAW &&
+		!strings.EqualFold(c.Outcome, stored.Faction1.Name) && !strings.EqualFold(c.Outcome, stored.Faction2.Name) {
+		return fmt.Errorf("%w: outcome must be a participant or %s", ErrInvalidConflict, OUTCOME_DRAW)
+	}
+	stored.Status = c.Status
+	stored.Faction1.Stake, stored.Faction1.WonDays = c.Faction1.Stake, c.Faction1.WonDays
+	stored.Faction2.Stake, stored.Faction2.WonDays = c.Faction2.Stake, c.Faction2.WonDays
+	stored.Outcome = c.Outcome
+	stored.Manual = c.Manual
+	stored.Updated = time.Now()
+	if stored.Status == CONFLICT_ENDED {
+		stored.end(stored.Updated)
+	} else {
+		stored.Outcome, stored.Ended = "", nil
+	}
+	if err = m.saveConflict(ctx, stored, tx); err != nil {
+		return err
+	}
+	*c = *stored
+	return nil
+}
@@ -0,0 +1,78 @@
+package factions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateObservation(t *testing.T) {
+	o := &ConflictObservation{
+		WarType:  "War",
+		Status:   "Active",
+		Faction1: ConflictSide{Name: " Close Encounters Corps ", WonDays: 2},
+		Faction2: ConflictSide{Name: "Tiethay Blue Mafia", WonDays: 1},
+	}
+	if err := ValidateObservation(o); err != nil {
+		t.Fatal(err)
+	}
+	if o.WarType != "war" || o.Status != CONFLICT_ACTIVE || o.Faction1.Name != "Close Encounters Corps" {
+		t.Errorf("fields are not normalized: %+v", o)
+	}
+	invalid := []*ConflictObservation{
+		{WarType: "skirmish", Faction1: ConflictSide{Name: "A"}, Faction2: ConflictSide{Name: "B"}},
+		{WarType: "war", Status: "won", Faction1: ConflictSide{Name: "A"}, Faction2: ConflictSide{Name: "B"}},
+		{WarType: "war", Faction1: ConflictSide{Name: "A"}},
+		{WarType: "war", Faction1: ConflictSide{Name: "A", WonDays: 8}, Faction2: ConflictSide{Name: "B"}},
+		{WarType: "election", Faction1: ConflictSide{Name: "A"}, Faction2: ConflictSide{Name: "a"}},
+		{WarType: "war", Faction1: ConflictSide{Name: strings.Repeat("x", MAX_NAME+1)}, Faction2: ConflictSide{Name: "B"}},
+		{WarType: "war", Faction1: ConflictSide{Name: "A", Stake: strings.Repeat("x", MAX_NAME+1)}, Faction2: ConflictSide{Name: "B"}},
+	}
+	for _, o := range invalid {
+		if err := ValidateObservation(o); !errors.Is(err, ErrInvalidConflict) {
+			t.Errorf("expected ErrInvalidConflict for %+v, got %v", o, err)
+		}
+	}
+}
+
+func TestConflictOutcome(t *testing.T) {
+	c := &Conflict{
+		Faction1: ConflictSide{Name: "A", WonDays: 4},
+		Faction2: ConflictSide{Name: "B", WonDays: 2},
+	}
+	if c.daysLeft() != 0 || c.outcome() != "A" {
+		t.Errorf("expected A to win, got %d days left and %s", c.daysLeft(), c.outcome())
+	}
+	c.Faction1.WonDays = 2
+	if c.daysLeft() != 2 || c.outcome() != OUTCOME_DRAW {
+		t.Errorf("expected a draw, got %d days left and %s", c.daysLeft(), c.outcome())
+	}
+}
+
+func TestSortByUrgency(t *testing.T) {
+	conflict := func(id uint64, status string, supported1 bool, days1, days2 int) *Conflict {
+		c := &Conflict{
+			Id:       id,
+			Status:   status,
+			Faction1: ConflictSide{Name: "A", WonDays: days1, Supported: supported1},
+			Faction2: ConflictSide{Name: "B", WonDays: days2, Supported: !supported1},
+		}
+		c.DaysLeft = c.daysLeft()
+		return c
+	}
+	conflicts := []*Conflict{
+		conflict(1, CONFLICT_PENDING, true, 0, 0),
+		conflict(2, CONFLICT_ACTIVE, true, 1, 0),
+		// supported side is behind, more urgent than 2
+		conflict(3, CONFLICT_ACTIVE, false, 1, 0),
+		// three days left for both sides
+		conflict(4, CONFLICT_ACTIVE, true, 3, 2),
+	}
+	SortByUrgency(conflicts)
+	expected := []uint64{4, 3, 2, 1}
+	for i, c := range conflicts {
+		if c.Id != expected[i] {
+			t.Fatalf("expected order %v, got conflict %d at %d", expected, c.Id, i)
+		}
+	}
+}
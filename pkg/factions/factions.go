@@ -1,4 +1,251 @@
 package factions
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var MODULE_NAME = "factions"
+
+var (
+	ErrInvalidFaction = errors.New("invalid faction")
+	ErrFactionExists  = errors.New("faction already exists")
+)
+
+// Minor faction of Elite Dangerous background simulation
 type GameFaction struct {
+	Id         uint64 `json:"id"`
+	Name       string `json:"name"`
+	Allegiance string `json:"allegiance"`
+	Government string `json:"government"`
+	HomeSystem string `json:"home_system,omitempty"`
+	// faction is supported by our squadron
+	SquadronSupported bool       `json:"squadron_supported"`
+	Created           *time.Time `json:"created"`
+	Updated           *time.Time `json:"updated"`
+}
+
+var ALLEGIANCES = []string{
+	"Alliance",
+	"Empire",
+	"Federation",
+	"Independent",
+	"Guardian",
+	"Pilots Federation",
+	"Thargoid",
+}
+
+var GOVERNMENTS = []string{
+	"Anarchy",
+	"Communism",
+	"Confederacy",
+	"Cooperative",
+	"Corporate",
+	"Democracy",
+	"Dictatorship",
+	"Feudal",
+	"Patronage",
+	"Prison Colony",
+	"Theocracy",
+	"Engineer",
+	"Private Ownership",
+}
+
+// Search parameters, zero values match everything
+type Filter struct {
+	// part of name or home system
+	Query      string
+	Allegiance string
+	Supported  *bool
+	Limit      int
+	Offset     int
+}
+
+const MAX_LIMIT = 500
+
+func NewFactionModule(db *pgxpool.Pool) *FactionModule {
+	return &FactionModule{
+		db: db,
+	}
+}
+
+type FactionModule struct {
+	db *pgxpool.Pool
+}
+
+func (m *FactionModule) Start(ctx context.Context) error {
+	if m.db != nil {
+		go m.detectLoop(ctx)
+	}
+	return nil
+}
+
+func oneOf(value string, known []string) (string, bool) {
+	for _, k := range known {
+		if strings.EqualFold(k, value) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Check faction fields, normalizing case of allegiance and government.
+func Validate(f *GameFaction) error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.HomeSystem = strings.TrimSpace(f.HomeSystem)
+	if f.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidFaction)
+	}
+	allegiance, ok := oneOf(f.Allegiance, ALLEGIANCES)
+	if !ok {
+		return fmt.Errorf("%w: unknown allegiance %s", ErrInvalidFaction, f.Allegiance)
+	}
+	government, ok := oneOf(f.Government, GOVERNMENTS)
+	if !ok {
+		return fmt.Errorf("%w: unknown government %s", ErrInvalidFaction, f.Government)
+	}
+	f.Allegiance, f.Government = allegiance, government
+	return nil
+}
+
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrFactionExists
+	}
+	return err
+}
+
+func (m *FactionModule) Create(ctx context.Context, f *GameFaction, tx pgx.Tx) error {
+	if err := Validate(f); err != nil {
+		return err
+	}
+	now := time.Now()
+	f.Created, f.Updated = &now, &now
+	err := tx.QueryRow(ctx, `
+	INSERT INTO game_factions (
+		name, allegiance, government, home_system, squadron_supported, created, updated
+	) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+	RETURNING id
+	`, f.Name, f.Allegiance, f.Government, f.HomeSystem, f.SquadronSupported,
+		f.Created, f.Updated,
+	).Scan(&f.Id)
+	return uniqueViolation(err)
+}
+
+// Replace fields of faction f.Id.
+func (m *FactionModule) Update(ctx context.Context, f *GameFaction, tx pgx.Tx) error {
+	if err := Validate(f); err != nil {
+		return err
+	}
+	err := tx.QueryRow(ctx, `
+	UPDATE game_factions SET
+		name = $2,
+		allegiance = $3,
+		government = $4,
+		home_system = NULLIF($5, ''),
+		squadron_supported = $6,
+		updated = now()
+	WHERE id = $1
+	RETURNING created, updated
+	`, f.Id, f.Name, f.Allegiance, f.Government, f.HomeSystem, f.SquadronSupported,
+	).Scan(&f.Created, &f.Updated)
+	return uniqueViolation(err)
+}
+
+func (m *FactionModule) Delete(ctx context.Context, id uint64, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM game_factions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+const columns = `id, name, allegiance, government, COALESCE(home_system, ''),
+	squadron_supported, created, updated`
+
+func scan(row pgx.Row) (*GameFaction, error) {
+	f := &GameFaction{}
+	err := row.Scan(
+		&f.Id,
+		&f.Name,
+		&f.Allegiance,
+		&f.Government,
+		&f.HomeSystem,
+		&f.SquadronSupported,
+		&f.Created,
+		&f.Updated,
+	)
+	return f, err
+}
+
+func (m *FactionModule) FindOne(ctx context.Context, id uint64, db api.DbConn) (*GameFaction, error) {
+	return scan(db.QueryRow(ctx, `SELECT `+columns+` FROM game_factions WHERE id = $1`, id))
+}
+
+// Find faction by name, ignoring case.
+func (m *FactionModule) FindByName(ctx context.Context, name string, db api.DbConn) (*GameFaction, error) {
+	return scan(db.QueryRow(ctx, `SELECT `+columns+` FROM game_factions WHERE lower(name) = lower($1)`, name))
+}
+
+// Factions matching filter, ordered by name.
+func (m *FactionModule) Search(ctx context.Context, filter *Filter, db api.DbConn) ([]*GameFaction, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > MAX_LIMIT {
+		limit = MAX_LIMIT
+	}
+	out := make([]*GameFaction, 0)
+	rows, err := db.Query(ctx, `
+	SELECT `+columns+` FROM game_factions
+	WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR home_system ILIKE '%' || $1 || '%')
+	AND ($2 = '' OR lower(allegiance) = lower($2))
+	AND ($3::boolean IS NULL OR squadron_supported = $3)
+	ORDER BY name
+	LIMIT $4 OFFSET $5
+	`, filter.Query, filter.Allegiance, filter.Supported, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Ids of all registered factions by lowercase name, not limited like Search.
+func (m *FactionModule) Ids(ctx context.Context, db api.DbConn) (map[string]uint64, error) {
+	out := make(map[string]uint64)
+	rows, err := db.Query(ctx, `SELECT id, name FROM game_factions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint64
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		out[strings.ToLower(name)] = id
+	}
+	return out, rows.Err()
 }
@@ -0,0 +1,26 @@
+package factions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	f := &GameFaction{Name: " Close Encounters Corps ", Allegiance: "independent", Government: "cooperative"}
+	if err := Validate(f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Close Encounters Corps" || f.Allegiance != "Independent" || f.Government != "Cooperative" {
+		t.Errorf("fields are not normalized: %+v", f)
+	}
+	invalid := []*GameFaction{
+		{Name: "", Allegiance: "Empire", Government: "Patronage"},
+		{Name: "Nobody", Allegiance: "Rebels", Government: "Patronage"},
+		{Name: "Nobody", Allegiance: "Empire", Government: "Monarchy"},
+	}
+	for _, f := range invalid {
+		if err := Validate(f); !errors.Is(err, ErrInvalidFaction) {
+			t.Errorf("expected ErrInvalidFaction for %+v, got %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package factions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Influence drop reported by Drops unless asked otherwise, 3%
+const DEFAULT_DROP = 0.03
+
+// Most snapshots accepted in one request
+const MAX_SNAPSHOTS = 500
+
+// Longest system name stored
+const MAX_SYSTEM = 64
+
+// Client clocks may run ahead of ours by this much
+const MAX_CLOCK_SKEW = 5 * time.Minute
+
+var HAPPINESS = []string{
+	"Elated",
+	"Happy",
+	"Discontented",
+	"Unhappy",
+	"Despondent",
+}
+
+// Faction standing in one system as of one BGS tick
+type InfluenceSnapshot struct {
+	Id        uint64    `json:"id"`
+	FactionId uint64    `json:"faction_id"`
+	System    string    `json:"system"`
+	Tick      time.Time `json:"tick"`
+	// fraction of system influence, 0..1
+	Influence        float64  `json:"influence"`
+	Happiness        string   `json:"happiness,omitempty"`
+	ActiveStates     []string `json:"active_states"`
+	PendingStates    []string `json:"pending_states"`
+	RecoveringStates []string `json:"recovering_states"`
+	// user who submitted the snapshot, nil for automatic sources
+	SubmittedBy *uint64    `json:"submitted_by,omitempty"`
+	Updated     *time.Time `json:"updated"`
+}
+
+// Influence lost by faction in system between two ticks
+type InfluenceDrop struct {
+	System       string    `json:"system"`
+	Tick         time.Time `json:"tick"`
+	PreviousTick time.Time `json:"previous_tick"`
+	Influence    float64   `json:"influence"`
+	Previous     float64   `json:"previous"`
+	Delta        float64   `json:"delta"`
+}
+
+func validStates(name string, states []string) ([]string, error) {
+	out := make([]string, 0, len(states))
+	for _, state := range states {
+		state = strings.TrimSpace(state)
+		if state == "" || len(state) > 32 {
+			return nil, fmt.Errorf("%w: invalid %s state %q", ErrInvalidFaction, name, state)
+		}
+		out = append(out, state)
+	}
+	return out, nil
+}
+
+// Check snapshot fields, normalizing happiness and states.
+func ValidateSnapshot(s *InfluenceSnapshot) error {
+	var err error
+	s.System = strings.TrimSpace(s.System)
+	if s.System == "" {
+		return fmt.Errorf("%w: system is required", ErrInvalidFaction)
+	}
+	if utf8.RuneCountInString(s.System) > MAX_SYSTEM {
+		return fmt.Errorf("%w: system is longer than %d characters", ErrInvalidFaction, MAX_SYSTEM)
+	}
+	if s.Tick.IsZero() {
+		return fmt.Errorf("%w: tick is required", ErrInvalidFaction)
+	}
+	// a future tick would be taken as the last one and stall tick detection
+	if s.Tick.After(time.Now().Add(MAX_CLOCK_SKEW)) {
+		return fmt.Errorf("%w: tick is in the future", ErrInvalidFaction)
+	}
+	if s.Influence < 0 || s.Influence > 1 {
+		return fmt.Errorf("%w: influence must be between 0 and 1", ErrInvalidFaction)
+	}
+	if s.Happiness != "" {
+		happiness, ok := oneOf(s.Happiness, HAPPINESS)
+		if !ok {
+			return fmt.Errorf("%w: unknown happiness %s", ErrInvalidFaction, s.Happiness)
+		}
+		s.Happiness = happiness
+	}
+	if s.ActiveStates, err = validStates("active", s.ActiveStates); err != nil {
+		return err
+	}
+	if s.PendingStates, err = validStates("pending", s.PendingStates); err != nil {
+		return err
+	}
+	if s.RecoveringStates, err = validStates("recovering", s.RecoveringStates); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Spelling of system in snapshots of faction stored before, system
+// itself when there are none. Systems are matched ignoring case.
+func (m *FactionModule) canonicalSystem(ctx context.Context, factionId uint64, system string, tx pgx.Tx) (string, error) {
+	var stored string
+	err := tx.QueryRow(ctx, `
+	SELECT system FROM faction_influence
+	WHERE faction_id = $1 AND lower(system) = lower($2)
+	LIMIT 1
+	`, factionId, system).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return system, nil
+	}
+	return stored, err
+}
+
+// Store snapshots of faction. A snapshot of the same system and tick
+// replaces the stored one.
+func (m *FactionModule) SaveInfluence(ctx context.Context, factionId uint64, snapshots []*InfluenceSnapshot, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "factions.save_influence", nil)
+	defer span.End()
+	if len(snapshots) > MAX_SNAPSHOTS {
+		return fmt.Errorf("%w: more than %d snapshots", ErrInvalidFaction, MAX_SNAPSHOTS)
+	}
+	for i, s := range snapshots {
+		if err := ValidateSnapshot(s); err != nil {
+			return fmt.Errorf("snapshot %d: %w", i, err)
+		}
+		s.FactionId = factionId
+		system, err := m.canonicalSystem(ctx, factionId, s.System, tx)
+		if err != nil {
+			return err
+		}
+		s.System = system
+		err = tx.QueryRow(ctx, `
+		INSERT INTO faction_influence (
+			faction_id, system, tick, influence, happiness,
+			active_states, pending_states, recovering_states, submitted_by, updated
+		) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, now())
+		ON CONFLICT (faction_id, lower(system), tick) DO UPDATE SET
+			influence = EXCLUDED.influence,
+			happiness = EXCLUDED.happiness,
+			active_states = EXCLUDED.active_states,
+			pending_states = EXCLUDED.pending_states,
+			recovering_states = EXCLUDED.recovering_states,
+			submitted_by = EXCLUDED.submitted_by,
+			updated = EXCLUDED.updated
+		RETURNING id, updated
+		`, factionId, s.System, s.Tick, s.Influence, s.Happiness,
+			s.ActiveStates, s.PendingStates, s.RecoveringStates, s.SubmittedBy,
+		).Scan(&s.Id, &s.Updated)
+		if err != nil {
+			return err
+		}
+	}
+	span.SetAttributes(
+		attribute.Int64("faction.id", int64(factionId)),
+		attribute.Int("influence.snapshots", len(snapshots)),
+	)
+	return nil
+}
+
+const snapshotColumns = `id, faction_id, system, tick, influence, COALESCE(happiness, ''),
+	active_states, pending_states, recovering_states, submitted_by, updated`
+
+func scanSnapshot(row pgx.Row) (*InfluenceSnapshot, error) {
+	s := &InfluenceSnapshot{}
+	err := row.Scan(
+		&s.Id,
+		&s.FactionId,
+		&s.System,
+		&s.Tick,
+		&s.Influence,
+		&s.Happiness,
+		&s.ActiveStates,
+		&s.PendingStates,
+		&s.RecoveringStates,
+		&s.SubmittedBy,
+		&s.Updated,
+	)
+	return s, err
+}
+
+// Snapshots of faction since given time, ordered by system and tick.
+// Empty system matches every system.
+func (m *FactionModule) InfluenceHistory(ctx context.Context, factionId uint64, system string, since time.Time, db api.DbConn) ([]*InfluenceSnapshot, error) {
+	out := make([]*InfluenceSnapshot, 0)
+	rows, err := db.Query(ctx, `
+	SELECT `+snapshotColumns+` FROM faction_influence
+	WHERE faction_id = $1
+	AND ($2 = '' OR lower(system) = lower($2))
+	AND tick >= $3
+	ORDER BY system, tick
+	`, factionId, system, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Latest snapshot of faction in each system with tick in [from, to).
+// Nil bound is open.
+func (m *FactionModule) Standings(ctx context.Context, factionId uint64, from, to *time.Time, db api.DbConn) (map[string]*InfluenceSnapshot, error) {
+	out := make(map[string]*InfluenceSnapshot)
+	rows, err := db.Query(ctx, `
+	SELECT DISTINCT ON (lower(system)) `+snapshotColumns+` FROM faction_influence
+	WHERE faction_id = $1
+	AND ($2::timestamptz IS NULL OR tick >= $2)
+	AND ($3::timestamptz IS NULL OR tick < $3)
+	ORDER BY lower(system), tick DESC
+	`, factionId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[s.System] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Systems where faction lost more than threshold influence over the last
+// BGS tick, biggest drop first. Snapshots are observed at different times
+// in every system, so the latest one since the tick is compared to the latest
+// one before it. Until a tick is detected, the latest snapshot of each system
+// is compared to the previous one.
+func (m *FactionModule) Drops(ctx context.Context, factionId uint64, threshold float64, db api.DbConn) ([]*InfluenceDrop, error) {
+	tick, err := m.LastTick(ctx, db)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m.latestDrops(ctx, factionId, threshold, db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	before, err := m.Standings(ctx, factionId, nil, &tick.Time, db)
+	if err != nil {
+		return nil, err
+	}
+	after, err := m.Standings(ctx, factionId, &tick.Time, nil, db)
+	if err != nil {
+		return nil, err
+	}
+	return StandingDrops(before, after, threshold), nil
+}
+
+// Systems where influence in after is lower than in before by more
+// than threshold, biggest drop first.
+func StandingDrops(before, after map[string]*InfluenceSnapshot, threshold float64) []*InfluenceDrop {
+	out := make([]*InfluenceDrop, 0)
+	for system, now := range after {
+		was, ok := before[system]
+		if !ok || was.Influence-now.Influence <= threshold {
+			continue
+		}
+		out = append(out, &InfluenceDrop{
+			System:       now.System,
+			Tick:         now.Tick,
+			PreviousTick: was.Tick,
+			Influence:    now.Influence,
+			Previous:     was.Influence,
+			Delta:        now.Influence - was.Influence,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Delta != out[j].Delta {
+			return out[i].Delta < out[j].Delta
+		}
+		return out[i].System < out[j].System
+	})
+	return out
+}
+
+// Drops between the latest and the previous snapshot of each system.
+func (m *FactionModule) latestDrops(ctx context.Context, factionId uint64, threshold float64, db api.DbConn) ([]*InfluenceDrop, error) {
+	out := make([]*InfluenceDrop, 0)
+	rows, err := db.Query(ctx, `
+	WITH history AS (
+		SELECT
+			system,
+			tick,
+			influence,
+			LAG(tick) OVER w AS previous_tick,
+			LAG(influence) OVER w AS previous,
+			LEAD(tick) OVER w AS next_tick
+		FROM faction_influence
+		WHERE faction_id = $1
+		WINDOW w AS (PARTITION BY lower(system) ORDER BY tick)
+	)
+	SELECT system, tick, previous_tick, influence, previous
+	FROM history
+	WHERE next_tick IS NULL
+	AND previous - influence > $2
+	ORDER BY previous - influence DESC, system
+	`, factionId, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &InfluenceDrop{}
+		err = rows.Scan(&d.System, &d.Tick, &d.PreviousTick, &d.Influence, &d.Previous)
+		if err != nil {
+			return nil, err
+		}
+		d.Delta = d.Influence - d.Previous
+		out = append(out, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func sameStates(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int, len(a))
+	for _, state := range a {
+		seen[strings.ToLower(state)]++
+	}
+	for _, state := range b {
+		seen[strings.ToLower(state)]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshots describe the same standing of faction in system.
+func SameStanding(a, b *InfluenceSnapshot) bool {
+	return math.Abs(a.Influence-b.Influence) < 1e-6 &&
+		a.Happiness == b.Happiness &&
+		sameStates(a.ActiveStates, b.ActiveStates) &&
+		sameStates(a.PendingStates, b.PendingStates) &&
+		sameStates(a.RecoveringStates, b.RecoveringStates)
+}
+
+// Store snapshot observed by an automatic source, which does not know
+// tick times. Snapshot is kept with its observation time as tick, and
+// only when it differs from the previous snapshot of the system.
+// Returns whether snapshot was stored.
+func (m *FactionModule) RecordInfluence(ctx context.Context, factionId uint64, s *InfluenceSnapshot, tx pgx.Tx) (bool, error) {
+	if err := ValidateSnapshot(s); err != nil {
+		return false, err
+	}
+	prev := &InfluenceSnapshot{}
+	err := tx.QueryRow(ctx, `
+	SELECT influence, COALESCE(happiness, ''), active_states, pending_states, recovering_states
+	FROM faction_influence
+	WHERE faction_id = $1 AND lower(system) = lower($2) AND tick <= $3
+	ORDER BY tick DESC
+	LIMIT 1
+	`, factionId, s.System, s.Tick).Scan(
+		&prev.Influence,
+		&prev.Happiness,
+		&prev.ActiveStates,
+		&prev.PendingStates,
+		&prev.RecoveringStates,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	if err == nil && SameStanding(prev, s) {
+		return false, nil
+	}
+	s.FactionId = factionId
+	if s.System, err = m.canonicalSystem(ctx, factionId, s.System, tx); err != nil {
+		return false, err
+	}
+	tag, err := tx.Exec(ctx, `
+	INSERT INTO faction_influence (
+		faction_id, system, tick, influence, happiness,
+		active_states, pending_states, recovering_states, submitted_by, updated
+	) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, now())
+	ON CONFLICT (faction_id, lower(system), tick) DO NOTHING
+	`, factionId, s.System, s.Tick, s.Influence, s.Happiness,
+		s.ActiveStates, s.PendingStates, s.RecoveringStates, s.SubmittedBy)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
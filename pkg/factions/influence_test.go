@@ -0,0 +1,59 @@
+package factions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSnapshot(t *testing.T) {
+	tick := time.Date(2022, 1, 2, 15, 0, 0, 0, time.UTC)
+	s := &InfluenceSnapshot{System: " Jotun ", Tick: tick, Influence: 0.42, Happiness: "happy", ActiveStates: []string{" Boom "}}
+	if err := ValidateSnapshot(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.System != "Jotun" || s.Happiness != "Happy" || s.ActiveStates[0] != "Boom" {
+		t.Errorf("fields are not normalized: %+v", s)
+	}
+	if s.PendingStates == nil || s.RecoveringStates == nil {
+		t.Error("empty states must not be nil")
+	}
+	invalid := []*InfluenceSnapshot{
+		{Tick: tick, Influence: 0.1},
+		{System: "Jotun", Influence: 0.1},
+		{System: "Jotun", Tick: tick, Influence: 1.5},
+		{System: "Jotun", Tick: tick, Influence: 0.1, Happiness: "Ecstatic"},
+		{System: "Jotun", Tick: tick, Influence: 0.1, PendingStates: []string{""}},
+		{System: strings.Repeat("x", MAX_SYSTEM+1), Tick: tick, Influence: 0.1},
+		{System: "Jotun", Tick: time.Now().Add(MAX_CLOCK_SKEW + time.Hour), Influence: 0.1},
+	}
+	for _, s := range invalid {
+		if err := ValidateSnapshot(s); !errors.Is(err, ErrInvalidFaction) {
+			t.Errorf("expected ErrInvalidFaction for %+v, got %v", s, err)
+		}
+	}
+}
+
+func TestStandingDrops(t *testing.T) {
+	tick := time.Date(2022, 1, 2, 15, 0, 0, 0, time.UTC)
+	before := map[string]*InfluenceSnapshot{
+		"Jotun": {System: "Jotun", Tick: tick.Add(-20 * time.Hour), Influence: 0.40},
+		"Sol":   {System: "Sol", Tick: tick.Add(-3 * time.Hour), Influence: 0.30},
+		"Lave":  {System: "Lave", Tick: tick.Add(-time.Hour), Influence: 0.10},
+	}
+	after := map[string]*InfluenceSnapshot{
+		"Jotun": {System: "Jotun", Tick: tick.Add(time.Hour), Influence: 0.35},
+		"Sol":   {System: "Sol", Tick: tick.Add(9 * time.Hour), Influence: 0.20},
+		"Lave":  {System: "Lave", Tick: tick.Add(2 * time.Hour), Influence: 0.09},
+		// first seen after the tick
+		"Diso": {System: "Diso", Tick: tick.Add(time.Hour), Influence: 0.01},
+	}
+	drops := StandingDrops(before, after, DEFAULT_DROP)
+	if len(drops) != 2 || drops[0].System != "Sol" || drops[1].System != "Jotun" {
+		t.Fatalf("unexpected drops %+v", drops)
+	}
+	if !drops[0].PreviousTick.Equal(tick.Add(-3*time.Hour)) || !drops[0].Tick.Equal(tick.Add(9*time.Hour)) {
+		t.Errorf("unexpected drop ticks %+v", drops[0])
+	}
+}
@@ -0,0 +1,260 @@
+package factions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/jackc/pgx/v4"
+)
+
+// Reports are generated for factions supported by the squadron only
+var ErrNotSupported = errors.New("faction is not supported by squadron")
+
+// States of a conflict between two factions of a system
+var CONFLICT_STATES = []string{"War", "Civil War", "Election"}
+
+const (
+	STATE_EXPANSION = "Expansion"
+	STATE_RETREAT   = "Retreat"
+)
+
+// Kinds of faction states
+const (
+	STATE_ACTIVE     = "active"
+	STATE_PENDING    = "pending"
+	STATE_RECOVERING = "recovering"
+)
+
+// Faction standing in system after a tick
+type SystemReport struct {
+	System    string  `json:"system"`
+	Influence float64 `json:"influence"`
+	// nil when faction was not seen in system before the tick
+	Previous  *float64 `json:"previous"`
+	Delta     float64  `json:"delta"`
+	Happiness string   `json:"happiness,omitempty"`
+}
+
+// State of faction in system started or ended at a tick
+type StateChange struct {
+	System string `json:"system"`
+	State  string `json:"state"`
+	// active, pending or recovering
+	Kind string `json:"kind"`
+}
+
+// What happened to faction at a tick
+type Report struct {
+	Faction  *GameFaction    `json:"faction"`
+	Tick     *Tick           `json:"tick"`
+	Previous *Tick           `json:"previous,omitempty"`
+	Systems  []*SystemReport `json:"systems"`
+	// systems where faction was seen before but not since the tick
+	Unobserved       []string       `json:"unobserved"`
+	StatesStarted    []*StateChange `json:"states_started"`
+	StatesEnded      []*StateChange `json:"states_ended"`
+	ConflictsStarted []*StateChange `json:"conflicts_started"`
+	ConflictsEnded   []*StateChange `json:"conflicts_ended"`
+	// systems where Expansion became active
+	Expansions []string `json:"expansions"`
+	// systems where Retreat became active
+	Retreats []string `json:"retreats"`
+	// systems faction was seen in for the first time
+	NewSystems []string `json:"new_systems"`
+}
+
+func hasState(states []string, state string) bool {
+	for _, s := range states {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func statesOf(s *InfluenceSnapshot, kind string) []string {
+	if s == nil {
+		return nil
+	}
+	switch kind {
+	case STATE_ACTIVE:
+		return s.ActiveStates
+	case STATE_PENDING:
+		return s.PendingStates
+	}
+	return s.RecoveringStates
+}
+
+// Pending or active conflict of snapshot, empty when there is none.
+func conflictOf(s *InfluenceSnapshot) (string, string) {
+	for _, kind := range []string{STATE_ACTIVE, STATE_PENDING} {
+		for _, state := range CONFLICT_STATES {
+			if hasState(statesOf(s, kind), state) {
+				return state, kind
+			}
+		}
+	}
+	return "", ""
+}
+
+// Compare latest standings of faction before tick with ones seen since.
+func BuildReport(faction *GameFaction, tick, previous *Tick, before, after map[string]*InfluenceSnapshot) *Report {
+	r := &Report{
+		Faction:          faction,
+		Tick:             tick,
+		Previous:         previous,
+		Systems:          make([]*SystemReport, 0, len(after)),
+		Unobserved:       make([]string, 0),
+		StatesStarted:    make([]*StateChange, 0),
+		StatesEnded:      make([]*StateChange, 0),
+		ConflictsStarted: make([]*StateChange, 0),
+		ConflictsEnded:   make([]*StateChange, 0),
+		Expansions:       make([]string, 0),
+		Retreats:         make([]string, 0),
+		NewSystems:       make([]string, 0),
+	}
+	for system := range before {
+		if after[system] == nil {
+			r.Unobserved = append(r.Unobserved, system)
+		}
+	}
+	sort.Strings(r.Unobserved)
+	systems := make([]string, 0, len(after))
+	for system := range after {
+		systems = append(systems, system)
+	}
+	sort.Strings(systems)
+	for _, system := range systems {
+		now, was := after[system], before[system]
+		sr := &SystemReport{
+			System:    system,
+			Influence: now.Influence,
+			Happiness: now.Happiness,
+		}
+		if was == nil {
+			r.NewSystems = append(r.NewSystems, system)
+		} else {
+			previous := was.Influence
+			sr.Previous = &previous
+			sr.Delta = now.Influence - previous
+		}
+		r.Systems = append(r.Systems, sr)
+		for _, kind := range []string{STATE_ACTIVE, STATE_PENDING, STATE_RECOVERING} {
+			for _, state := range statesOf(now, kind) {
+				if !hasState(statesOf(was, kind), state) {
+					r.StatesStarted = append(r.StatesStarted, &StateChange{system, state, kind})
+				}
+			}
+			for _, state := range statesOf(was, kind) {
+				if !hasState(statesOf(now, kind), state) {
+					r.StatesEnded = append(r.StatesEnded, &StateChange{system, state, kind})
+				}
+			}
+		}
+		conflict, kind := conflictOf(now)
+		previousConflict, previousKind := conflictOf(was)
+		if conflict != "" && previousConflict == "" {
+			r.ConflictsStarted = append(r.ConflictsStarted, &StateChange{system, conflict, kind})
+		}
+		if previousConflict != "" && conflict == "" {
+			r.ConflictsEnded = append(r.ConflictsEnded, &StateChange{system, previousConflict, previousKind})
+		}
+		if hasState(now.ActiveStates, STATE_EXPANSION) && !hasState(statesOf(was, STATE_ACTIVE), STATE_EXPANSION) {
+			r.Expansions = append(r.Expansions, system)
+		}
+		if hasState(now.ActiveStates, STATE_RETREAT) && !hasState(statesOf(was, STATE_ACTIVE), STATE_RETREAT) {
+			r.Retreats = append(r.Retreats, system)
+		}
+	}
+	return r
+}
+
+// Report on faction at tick, from snapshots observed until the next tick.
+func (m *FactionModule) Report(ctx context.Context, faction *GameFaction, tick *Tick, db api.DbConn) (*Report, error) {
+	if !faction.SquadronSupported {
+		return nil, ErrNotSupported
+	}
+	previous, err := m.AdjacentTick(ctx, tick.Time, false, db)
+	if errors.Is(err, pgx.ErrNoRows) {
+		previous = nil
+	} else if err != nil {
+		return nil, err
+	}
+	var until *time.Time
+	next, err := m.AdjacentTick(ctx, tick.Time, true, db)
+	if err == nil {
+		until = &next.Time
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	before, err := m.Standings(ctx, faction.Id, nil, &tick.Time, db)
+	if err != nil {
+		return nil, err
+	}
+	after, err := m.Standings(ctx, faction.Id, &tick.Time, until, db)
+	if err != nil {
+		return nil, err
+	}
+	return BuildReport(faction, tick, previous, before, after), nil
+}
+
+const REPORT_TIME = "2006-01-02 15:04 MST"
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.1f%%", v*100)
+}
+
+func changeList(b *strings.Builder, title string, changes []*StateChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n", title)
+	for _, c := range changes {
+		fmt.Fprintf(b, "- %s: %s (%s)\n", c.System, c.State, c.Kind)
+	}
+}
+
+func systemList(b *strings.Builder, title string, systems []string) {
+	if len(systems) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n", title)
+	for _, s := range systems {
+		fmt.Fprintf(b, "- %s\n", s)
+	}
+}
+
+// Report as a Markdown document, sections without events are left out.
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s, tick %s\n", r.Faction.Name, r.Tick.Time.UTC().Format(REPORT_TIME))
+	if r.Previous != nil {
+		fmt.Fprintf(&b, "\nPrevious tick: %s\n", r.Previous.Time.UTC().Format(REPORT_TIME))
+	}
+	if len(r.Systems) > 0 {
+		b.WriteString("\n## Influence\n")
+		b.WriteString("| System | Influence | Change | Happiness |\n")
+		b.WriteString("|---|---:|---:|---|\n")
+		for _, s := range r.Systems {
+			change := "new"
+			if s.Previous != nil {
+				change = fmt.Sprintf("%+.1f%%", s.Delta*100)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", s.System, percent(s.Influence), change, s.Happiness)
+		}
+	}
+	changeList(&b, "Conflicts started", r.ConflictsStarted)
+	changeList(&b, "Conflicts ended", r.ConflictsEnded)
+	systemList(&b, "Expansions", r.Expansions)
+	systemList(&b, "Retreats", r.Retreats)
+	systemList(&b, "New systems", r.NewSystems)
+	changeList(&b, "States started", r.StatesStarted)
+	changeList(&b, "States ended", r.StatesEnded)
+	systemList(&b, "Not observed since the tick", r.Unobserved)
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package factions
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	faction := &GameFaction{Id: 1, Name: "Close Encounters Corps", SquadronSupported: true}
+	tick := &Tick{Id: 2, Time: time.Date(2022, 3, 2, 14, 35, 0, 0, time.UTC)}
+	previous := &Tick{Id: 1, Time: time.Date(2022, 3, 1, 14, 30, 0, 0, time.UTC)}
+	before := map[string]*InfluenceSnapshot{
+		"Jotun":   {System: "Jotun", Influence: 0.45, ActiveStates: []string{"Boom"}, PendingStates: []string{"Expansion"}},
+		"Sol":     {System: "Sol", Influence: 0.20, ActiveStates: []string{"War"}},
+		"Achenar": {System: "Achenar", Influence: 0.10},
+	}
+	after := map[string]*InfluenceSnapshot{
+		"Jotun": {System: "Jotun", Influence: 0.47, Happiness: "Happy", ActiveStates: []string{"Boom", "Expansion"}, PendingStates: []string{"Election"}},
+		"Sol":   {System: "Sol", Influence: 0.15, ActiveStates: []string{"Retreat"}, RecoveringStates: []string{"War"}},
+		"Maia":  {System: "Maia", Influence: 0.05},
+	}
+	r := BuildReport(faction, tick, previous, before, after)
+	if len(r.Systems) != 3 || r.Systems[0].System != "Jotun" || r.Systems[1].Previous != nil {
+		t.Fatalf("unexpected systems %+v", r.Systems)
+	}
+	if d := r.Systems[0].Delta; d < 0.0199 || d > 0.0201 {
+		t.Errorf("unexpected delta %v", d)
+	}
+	if len(r.Unobserved) != 1 || r.Unobserved[0] != "Achenar" {
+		t.Errorf("unexpected unobserved %v", r.Unobserved)
+	}
+	if len(r.NewSystems) != 1 || r.NewSystems[0] != "Maia" {
+		t.Errorf("unexpected new systems %v", r.NewSystems)
+	}
+	if len(r.ConflictsStarted) != 1 || r.ConflictsStarted[0].State != "Election" || r.ConflictsStarted[0].Kind != STATE_PENDING {
+		t.Errorf("unexpected conflicts started %+v", r.ConflictsStarted)
+	}
+	if len(r.ConflictsEnded) != 1 || r.ConflictsEnded[0].System != "Sol" {
+		t.Errorf("unexpected conflicts ended %+v", r.ConflictsEnded)
+	}
+	if len(r.Expansions) != 1 || r.Expansions[0] != "Jotun" || len(r.Retreats) != 1 || r.Retreats[0] != "Sol" {
+		t.Errorf("unexpected expansions %v and retreats %v", r.Expansions, r.Retreats)
+	}
+	// Jotun: Expansion and Election started, Expansion pending ended; Sol: Retreat and War recovering started, War ended
+	if len(r.StatesStarted) != 4 || len(r.StatesEnded) != 2 {
+		t.Errorf("unexpected state changes %+v %+v", r.StatesStarted, r.StatesEnded)
+	}
+	md := r.Markdown()
+	for _, line := range []string{
+		"# Close Encounters Corps, tick 2022-03-02 14:35 UTC",
+		"| Jotun | 47.0% | +2.0% | Happy |",
+		"| Maia | 5.0% | new |  |",
+		"## Conflicts started\n- Jotun: Election (pending)",
+		"## Not observed since the tick\n- Achenar",
+	} {
+		if !strings.Contains(md, line) {
+			t.Errorf("markdown lacks %q:\n%s", line, md)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package factions
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tick detection parameters. The BGS updates every system once a day,
+// so a tick shows up as influence changes in many systems shortly after it.
+const (
+	// Changes this close to the first one belong to the same tick
+	TICK_WINDOW = 2 * time.Hour
+	// Systems that have to change for a tick to be detected
+	TICK_MIN_SYSTEMS = 3
+	// Ticks are at least this far apart
+	TICK_MIN_GAP = 12 * time.Hour
+	// How often to look for a new tick
+	TICK_CHECK_INTERVAL = 5 * time.Minute
+)
+
+// Advisory lock held while detecting ticks, so replicas do not race
+const TICK_LOCK_KEY = 0x74696b
+
+// Daily BGS update
+type Tick struct {
+	Id   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	// systems which changed within TICK_WINDOW of the tick
+	Systems  int        `json:"systems"`
+	Detected *time.Time `json:"detected"`
+}
+
+// Influence of some faction in system changed, as observed at Time
+type InfluenceChange struct {
+	System string
+	Time   time.Time
+}
+
+// First tick after last in changes ordered by time, nil when there is none.
+func DetectTick(changes []*InfluenceChange, last *time.Time) *Tick {
+	for i, c := range changes {
+		if last != nil && c.Time.Sub(*last) < TICK_MIN_GAP {
+			continue
+		}
+		systems := make(map[string]bool)
+		for _, next := range changes[i:] {
+			if next.Time.Sub(c.Time) > TICK_WINDOW {
+				break
+			}
+			systems[strings.ToLower(next.System)] = true
+		}
+		if len(systems) >= TICK_MIN_SYSTEMS {
+			return &Tick{Time: c.Time, Systems: len(systems)}
+		}
+	}
+	return nil
+}
+
+func (m *FactionModule) detectLoop(ctx context.Context) {
+	ticker := time.NewTicker(TICK_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		ticks, err := m.DetectTicks(ctx)
+		if err != nil {
+			log.Println("bgs tick detection:", err)
+		}
+		for _, t := range ticks {
+			log.Println("bgs tick detected:", t.Time, "systems:", t.Systems)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Record ticks visible in influence changes since the last known tick.
+// Safe to run on several replicas.
+func (m *FactionModule) DetectTicks(ctx context.Context) ([]*Tick, error) {
+	ctx, span := tracer.NewSpan(ctx, "factions.detect_ticks", nil)
+	defer span.End()
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, TICK_LOCK_KEY); err != nil {
+		return nil, err
+	}
+	var since *time.Time
+	last, err := m.LastTick(ctx, tx)
+	if err == nil {
+		since = &last.Time
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	// snapshots claiming to be from the future must not pass for a tick,
+	// it would stop detection until then
+	changes, err := m.InfluenceChanges(ctx, since, time.Now(), tx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Tick, 0)
+	for {
+		tick := DetectTick(changes, since)
+		if tick == nil {
+			break
+		}
+		if err = m.SaveTick(ctx, tick, tx); err != nil {
+			return nil, err
+		}
+		out = append(out, tick)
+		since = &tick.Time
+	}
+	span.SetAttributes(attribute.Int("bgs.ticks", len(out)))
+	return out, tx.Commit(ctx)
+}
+
+// Observations where influence of a faction differs from the
+// previous snapshot of the system, after since up to until, ordered by time.
+// Only snapshots after since are scanned, the one before the first of
+// each system is looked up by index.
+func (m *FactionModule) InfluenceChanges(ctx context.Context, since *time.Time, until time.Time, db api.DbConn) ([]*InfluenceChange, error) {
+	out := make([]*InfluenceChange, 0)
+	rows, err := db.Query(ctx, `
+	SELECT system, tick FROM (
+		SELECT
+			f.system,
+			f.tick,
+			f.influence,
+			COALESCE(
+				LAG(f.influence) OVER (PARTITION BY f.faction_id, lower(f.system) ORDER BY f.tick),
+				(
+					SELECT p.influence FROM faction_influence p
+					WHERE p.faction_id = f.faction_id AND lower(p.system) = lower(f.system)
+					AND p.tick < f.tick
+					ORDER BY p.tick DESC
+					LIMIT 1
+				)
+			) AS previous
+		FROM faction_influence f
+		WHERE ($1::timestamptz IS NULL OR f.tick > $1) AND f.tick <= $2
+	) history
+	WHERE previous IS NOT NULL
+	AND abs(influence - previous) > 1e-6
+	ORDER BY tick
+	`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := &InfluenceChange{}
+		if err = rows.Scan(&c.System, &c.Time); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *FactionModule) SaveTick(ctx context.Context, tick *Tick, tx pgx.Tx) error {
+	return tx.QueryRow(ctx, `
+	INSERT INTO bgs_ticks (time, systems, detected)
+	VALUES ($1, $2, now())
+	RETURNING id, detected
+	`, tick.Time, tick.Systems).Scan(&tick.Id, &tick.Detected)
+}
+
+func scanTick(row pgx.Row) (*Tick, error) {
+	t := &Tick{}
+	err := row.Scan(&t.Id, &t.Time, &t.Systems, &t.Detected)
+	return t, err
+}
+
+func (m *FactionModule) LastTick(ctx context.Context, db api.DbConn) (*Tick, error) {
+	return scanTick(db.QueryRow(ctx, `
+	SELECT id, time, systems, detected FROM bgs_ticks ORDER BY time DESC LIMIT 1
+	`))
+}
+
+func (m *FactionModule) FindTick(ctx context.Context, id uint64, db api.DbConn) (*Tick, error) {
+	return scanTick(db.QueryRow(ctx, `
+	SELECT id, time, systems, detected FROM bgs_ticks WHERE id = $1
+	`, id))
+}
+
+// Tick right before or after t, pgx.ErrNoRows when there is none.
+func (m *FactionModule) AdjacentTick(ctx context.Context, t time.Time, after bool, db api.DbConn) (*Tick, error) {
+	if after {
+		return scanTick(db.QueryRow(ctx, `
+		SELECT id, time, systems, detected FROM bgs_ticks WHERE time > $1 ORDER BY time LIMIT 1
+		`, t))
+	}
+	return scanTick(db.QueryRow(ctx, `
+	SELECT id, time, systems, detected FROM bgs_ticks WHERE time < $1 ORDER BY time DESC LIMIT 1
+	`, t))
+}
+
+// Most recent ticks, newest first.
+func (m *FactionModule) Ticks(ctx context.Context, limit int, db api.DbConn) ([]*Tick, error) {
+	out := make([]*Tick, 0)
+	rows, err := db.Query(ctx, `
+	SELECT id, time, systems, detected FROM bgs_ticks ORDER BY time DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanTick(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
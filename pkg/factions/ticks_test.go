@@ -0,0 +1,43 @@
+package factions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectTick(t *testing.T) {
+	start := time.Date(2022, 3, 1, 14, 30, 0, 0, time.UTC)
+	at := func(minutes int, system string) *InfluenceChange {
+		return &InfluenceChange{System: system, Time: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+	changes := []*InfluenceChange{
+		// late submission of yesterday's numbers, alone
+		at(-600, "Sol"),
+		at(0, "Jotun"),
+		at(20, "jotun"),
+		at(45, "Achenar"),
+		at(90, "Sol"),
+		// next day
+		at(24*60+5, "Jotun"),
+		at(24*60+30, "Sol"),
+		at(24*60+200, "Achenar"),
+	}
+	tick := DetectTick(changes, nil)
+	if tick == nil || !tick.Time.Equal(start) || tick.Systems != 3 {
+		t.Fatalf("unexpected tick %+v", tick)
+	}
+	// too close to the previous tick
+	if next := DetectTick(changes[2:5], &tick.Time); next != nil {
+		t.Errorf("unexpected tick %+v", next)
+	}
+	// next day's changes are too spread out
+	if next := DetectTick(changes, &tick.Time); next != nil {
+		t.Errorf("unexpected tick %+v", next)
+	}
+	// one more system changed within the window
+	maia := []*InfluenceChange{changes[5], changes[6], at(24*60+60, "Maia"), changes[7]}
+	next := DetectTick(maia, &tick.Time)
+	if next == nil || !next.Time.Equal(start.Add(24*time.Hour+5*time.Minute)) {
+		t.Errorf("unexpected tick %+v", next)
+	}
+}
@@ -0,0 +1,207 @@
+package frontier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var MODULE_NAME = "frontier"
+
+// Frontier rejected token, user has to log in again
+var ErrReauthRequired = errors.New("frontier reauthorization required")
+
+// Companion API of Elite Dangerous
+const API_URL = "https://companion.orerve.net"
+
+func NewFrontierModule(api ApiClient, db *pgxpool.Pool, cfg *config.Config) *FrontierModule {
+	if api == nil {
+		api = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+	m := &FrontierModule{
+		client: api,
+		db:     db,
+		config: cfg,
+	}
+	m.refresher = auth.NewTokenRefresher(MODULE_NAME, "frontier_accounts", m.RefreshToken, ErrReauthRequired, db)
+	return m
+}
+
+type ApiClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type FrontierModule struct {
+	client    ApiClient
+	db        *pgxpool.Pool
+	config    *config.Config
+	refresher *auth.TokenRefresher
+}
+
+func (m *FrontierModule) Start(ctx context.Context) error {
+	if m.db != nil && m.config.FrontierClientId != "" && m.config.FrontierRefreshInterval > 0 {
+		go m.refresher.Loop(ctx, m.config.FrontierRefreshInterval)
+	}
+	if m.db != nil && m.config.FrontierSyncInterval > 0 {
+		go m.syncLoop(ctx)
+	}
+	return nil
+}
+
+// Request commander profile using oauth token info
+func (m *FrontierModule) FetchApi(ctx context.Context, token *auth.OauthToken) (*items.FrontierAccount, error) {
+	raw, err := m.fetch(ctx, "/profile", token.TokenType, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("frontier profile is empty")
+	}
+	var profile items.FrontierProfile
+	if err = json.Unmarshal(raw, &profile); err != nil {
+		return nil, err
+	}
+	if profile.Commander.Name == "" {
+		return nil, fmt.Errorf("frontier profile has no commander")
+	}
+	now := time.Now()
+	acc := items.FrontierAccount{
+		Cmdr:         profile.Commander.Name,
+		CapiResponse: raw,
+		Created:      &now,
+		Updated:      &now,
+		// token info
+		AccessToken:    token.AccessToken,
+		TokenType:      token.TokenType,
+		TokenExpiresIn: token.Expiry,
+		RefreshToken:   token.RefreshToken,
+	}
+	return &acc, nil
+}
+
+// Create account with userId and return saved id
+func (m *FrontierModule) NewAccount(ctx context.Context, account *items.FrontierAccount, userId uint64, tx pgx.Tx) (uint64, error) {
+	var id uint64
+	err := tx.QueryRow(ctx, `
+	INSERT INTO frontier_accounts (
+		user_id,
+		cmdr,
+		capi_response,
+		created,
+		updated,
+		access_token,
+		token_type,
+		token_expires_in,
+		refresh_token
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+	`, userId, account.Cmdr, account.CapiResponse, account.Created,
+		account.Updated, account.AccessToken, account.TokenType,
+		account.TokenExpiresIn, account.RefreshToken,
+	).Scan(&id)
+	return id, err
+}
+
+// Store freshly fetched profile and token info of account.
+// Account is synced again soon after.
+func (m *FrontierModule) UpdateAccount(ctx context.Context, id uint64, fresh *items.FrontierAccount, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE frontier_accounts SET
+		capi_response = $2,
+		access_token = $3,
+		token_type = $4,
+		token_expires_in = $5,
+		refresh_token = $6,
+		reauth_required = false,
+		updated = now(),
+		synced = NULL
+	WHERE id = $1
+	`, id, fresh.CapiResponse, fresh.AccessToken, fresh.TokenType,
+		fresh.TokenExpiresIn, fresh.RefreshToken)
+	return err
+}
+
+// Find user owning frontier account of commander.
+func (m *FrontierModule) FindUser(ctx context.Context, cmdr string, tx pgx.Tx) (*items.User, error) {
+	pr := &items.Principal{}
+	usr := &items.User{}
+	acc := &items.FrontierAccount{}
+	err := tx.QueryRow(ctx, `
+	SELECT
+		u.id,
+		pr.id,
+		pr.is_admin,
+		pr.created_on,
+		pr.last_login,
+		pr.state,
+		fa.id,
+		fa.user_id,
+		fa.cmdr,
+		fa.created,
+		fa.updated
+	FROM users u
+	JOIN frontier_accounts fa ON u.id = fa.user_id
+	JOIN principals pr ON pr.id = u.principal_id
+	WHERE fa.cmdr = $1
+	`, cmdr).Scan(
+		&usr.Id,
+		&pr.Id,
+		&pr.Admin,
+		&pr.CreatedOn,
+		&pr.LastLogin,
+		&pr.State,
+		&acc.Id,
+		&acc.UserId,
+		&acc.Cmdr,
+		&acc.Created,
+		&acc.Updated,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil // user not found -- not an error!
+	}
+	if err != nil {
+		return nil, err
+	}
+	usr.Principal = pr
+	usr.Frontier = acc
+	return usr, nil
+}
+
+// Return every frontier account linked to user.
+func (m *FrontierModule) FindAccounts(ctx context.Context, userId uint64, db api.DbConn) ([]*items.FrontierAccount, error) {
+	out := make([]*items.FrontierAccount, 0)
+	rows, err := db.Query(ctx, `
+	SELECT id, user_id, cmdr, created, updated
+	FROM frontier_accounts
+	WHERE user_id = $1
+	ORDER BY id
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		acc := &items.FrontierAccount{}
+		err = rows.Scan(&acc.Id, &acc.UserId, &acc.Cmdr, &acc.Created, &acc.Updated)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, acc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package frontier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/auth"
+	"github.com/jackc/pgx/v4"
+)
+
+// Frontier oauth server
+const AUTH_URL = "https://auth.frontierstore.net"
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Exchange refresh token for a new oauth token.
+func (m *FrontierModule) RefreshToken(ctx context.Context, refreshToken string) (*auth.OauthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("client_id", m.config.FrontierClientId)
+	if m.config.FrontierClientSecret != "" {
+		form.Set("client_secret", m.config.FrontierClientSecret)
+	}
+	form.Set("refresh_token", refreshToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", AUTH_URL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		// refresh token expired or was revoked
+		return nil, ErrReauthRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("frontier token refresh failed: %v", resp.StatusCode)
+	}
+	var body tokenResponse
+	if err = json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	return &auth.OauthToken{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// Store new token info of account and clear reauth flag.
+func (m *FrontierModule) UpdateTokens(ctx context.Context, id uint64, token *auth.OauthToken, tx pgx.Tx) error {
+	return m.refresher.UpdateTokens(ctx, id, token, tx)
+}
+
+// Refresh tokens of every account expiring soon, see auth.TokenRefresher.
+func (m *FrontierModule) RefreshExpiring(ctx context.Context) (int, error) {
+	return m.refresher.RefreshExpiring(ctx)
+}
@@ -0,0 +1,302 @@
+package frontier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+)
+
+// Request CAPI endpoint with token of account. Missing data,
+// e.g. market of undocked commander, is reported as nil body.
+func (m *FrontierModule) fetch(ctx context.Context, path string, tokenType string, accessToken string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", API_URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%v %v", tokenType, accessToken))
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return raw, nil
+	case http.StatusNoContent, http.StatusNotFound:
+		return nil, nil
+	case http.StatusUnauthorized:
+		return nil, ErrReauthRequired
+	}
+	return nil, fmt.Errorf("frontier api request %s failed: %v", path, resp.StatusCode)
+}
+
+// Structured commander state from CAPI /profile response.
+func NewCommander(p *items.FrontierProfile) *items.Commander {
+	cmdr := &items.Commander{
+		CommanderId: p.Commander.Id,
+		Credits:     p.Commander.Credits,
+		Debt:        p.Commander.Debt,
+		Alive:       p.Commander.Alive,
+		Docked:      p.Commander.Docked,
+		Ranks:       p.Commander.Rank,
+	}
+	if cmdr.Ranks == nil {
+		cmdr.Ranks = map[string]int{}
+	}
+	if p.LastSystem != nil {
+		cmdr.System = p.LastSystem.Name
+	}
+	if p.LastStarport != nil && p.Commander.Docked {
+		cmdr.Station = p.LastStarport.Name
+	}
+	if p.Ship != nil {
+		cmdr.ShipId = p.Ship.Id
+		cmdr.ShipType = p.Ship.Name
+		cmdr.ShipName = p.Ship.ShipName
+		cmdr.ShipIdent = p.Ship.ShipID
+	}
+	if p.Squadron != nil {
+		cmdr.SquadronId = p.Squadron.Id
+		cmdr.SquadronName = p.Squadron.Name
+		cmdr.SquadronTag = p.Squadron.Tag
+		cmdr.SquadronRank = p.Squadron.Rank
+	}
+	return cmdr
+}
+
+// Pull /profile, and /market with /shipyard when docked, of account
+// and store them.
+func (m *FrontierModule) Sync(ctx context.Context, acc *items.FrontierAccount, tx pgx.Tx) error {
+	ctx, span := tracer.NewSpan(ctx, "frontier.sync", nil)
+	defer span.End()
+	profile, err := m.fetch(ctx, "/profile", acc.TokenType, acc.AccessToken)
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return fmt.Errorf("frontier profile is empty")
+	}
+	var p items.FrontierProfile
+	if err = json.Unmarshal(profile, &p); err != nil {
+		return err
+	}
+	if p.Commander.Name == "" {
+		return fmt.Errorf("frontier profile has no commander")
+	}
+	cmdr := NewCommander(&p)
+	if cmdr.Docked {
+		cmdr.Market, err = m.fetch(ctx, "/market", acc.TokenType, acc.AccessToken)
+		if err != nil {
+			return err
+		}
+		cmdr.Shipyard, err = m.fetch(ctx, "/shipyard", acc.TokenType, acc.AccessToken)
+		if err != nil {
+			return err
+		}
+		if cmdr.Market != nil {
+			var market struct {
+				Id int64 `json:"id"`
+			}
+			if err = json.Unmarshal(cmdr.Market, &market); err != nil {
+				return err
+			}
+			cmdr.MarketId = market.Id
+		}
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE frontier_accounts SET
+		cmdr = $2,
+		capi_response = $3,
+		updated = now(),
+		synced = now()
+	WHERE id = $1
+	`, acc.Id, p.Commander.Name, json.RawMessage(profile))
+	if err != nil {
+		return err
+	}
+	acc.Cmdr = p.Commander.Name
+	acc.CapiResponse = profile
+	acc.Commander = cmdr
+	return m.SaveCommander(ctx, acc.Id, cmdr, tx)
+}
+
+// Replace stored state of commander.
+func (m *FrontierModule) SaveCommander(ctx context.Context, accountId uint64, c *items.Commander, tx pgx.Tx) error {
+	now := time.Now()
+	c.Synced = &now
+	_, err := tx.Exec(ctx, `
+	INSERT INTO frontier_commanders (
+		account_id, commander_id, credits, debt, alive, docked,
+		system_name, station_name, ship_id, ship_type, ship_name, ship_ident,
+		ranks, squadron_id, squadron_name, squadron_tag, squadron_rank,
+		market_id, market, shipyard, synced
+	) VALUES (
+		$1, $2, $3, $4, $5, $6,
+		NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''),
+		$13, NULLIF($14, 0), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, 0),
+		NULLIF($18, 0), $19, $20, $21
+	)
+	ON CONFLICT (account_id) DO UPDATE SET
+		commander_id = EXCLUDED.commander_id,
+		credits = EXCLUDED.credits,
+		debt = EXCLUDED.debt,
+		alive = EXCLUDED.alive,
+		docked = EXCLUDED.docked,
+		system_name = EXCLUDED.system_name,
+		station_name = EXCLUDED.station_name,
+		ship_id = EXCLUDED.ship_id,
+		ship_type = EXCLUDED.ship_type,
+		ship_name = EXCLUDED.ship_name,
+		ship_ident = EXCLUDED.ship_ident,
+		ranks = EXCLUDED.ranks,
+		squadron_id = EXCLUDED.squadron_id,
+		squadron_name = EXCLUDED.squadron_name,
+		squadron_tag = EXCLUDED.squadron_tag,
+		squadron_rank = EXCLUDED.squadron_rank,
+		market_id = EXCLUDED.market_id,
+		market = EXCLUDED.market,
+		shipyard = EXCLUDED.shipyard,
+		synced = EXCLUDED.synced
+	`, accountId, c.CommanderId, c.Credits, c.Debt, c.Alive, c.Docked,
+		c.System, c.Station, c.ShipId, c.ShipType, c.ShipName, c.ShipIdent,
+		c.Ranks, c.SquadronId, c.SquadronName, c.SquadronTag, c.SquadronRank,
+		c.MarketId, nullJson(c.Market), nullJson(c.Shipyard), c.Synced)
+	return err
+}
+
+func nullJson(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	return raw
+}
+
+// Last synced state of commander, nil if never synced.
+func (m *FrontierModule) FindCommander(ctx context.Context, accountId uint64, db api.DbConn) (*items.Commander, error) {
+	c := &items.Commander{}
+	err := db.QueryRow(ctx, `
+	SELECT commander_id, credits, debt, alive, docked,
+		COALESCE(system_name, ''), COALESCE(station_name, ''), COALESCE(ship_id, 0),
+		COALESCE(ship_type, ''), COALESCE(ship_name, ''), COALESCE(ship_ident, ''),
+		ranks, COALESCE(squadron_id, 0), COALESCE(squadron_name, ''),
+		COALESCE(squadron_tag, ''), COALESCE(squadron_rank, 0),
+		COALESCE(market_id, 0), market, shipyard, synced
+	FROM frontier_commanders
+	WHERE account_id = $1
+	`, accountId).Scan(
+		&c.CommanderId, &c.Credits, &c.Debt, &c.Alive, &c.Docked,
+		&c.System, &c.Station, &c.ShipId,
+		&c.ShipType, &c.ShipName, &c.ShipIdent,
+		&c.Ranks, &c.SquadronId, &c.SquadronName,
+		&c.SquadronTag, &c.SquadronRank,
+		&c.MarketId, &c.Market, &c.Shipyard, &c.Synced,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil // never synced -- not an error!
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (m *FrontierModule) syncLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		n, err := m.SyncStale(ctx)
+		if err != nil {
+			log.Println("frontier sync:", err)
+		} else if n > 0 {
+			log.Println("frontier commanders synced:", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync every account with a valid token not synced for
+// FrontierSyncInterval. Safe to run on several replicas.
+func (m *FrontierModule) SyncStale(ctx context.Context) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, "frontier.sync_stale", nil)
+	defer span.End()
+	count := 0
+	for {
+		done, err := m.syncNext(ctx)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "sync error")
+			return count, err
+		}
+		if done {
+			return count, nil
+		}
+		count++
+	}
+}
+
+func (m *FrontierModule) syncNext(ctx context.Context) (bool, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	acc := &items.FrontierAccount{}
+	err = tx.QueryRow(ctx, `
+	SELECT id, user_id, cmdr, access_token, token_type FROM frontier_accounts
+	WHERE NOT reauth_required AND token_expires_in > now()
+	AND (synced IS NULL OR synced < $1)
+	ORDER BY synced NULLS FIRST
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+	`, time.Now().Add(-m.config.FrontierSyncInterval)).Scan(
+		&acc.Id, &acc.UserId, &acc.Cmdr, &acc.AccessToken, &acc.TokenType,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// savepoint, so failed sync can still be marked as attempted
+	sub, err := tx.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = m.Sync(ctx, acc, sub)
+	if err == nil {
+		err = sub.Commit(ctx)
+	}
+	if err != nil {
+		sub.Rollback(ctx)
+		log.Printf("frontier sync of account %v: %s\n", acc.Id, err)
+		reauth := errors.Is(err, ErrReauthRequired)
+		_, err = tx.Exec(ctx, `
+		UPDATE frontier_accounts SET
+			synced = now(),
+			reauth_required = reauth_required OR $2
+		WHERE id = $1
+		`, acc.Id, reauth)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, tx.Commit(ctx)
+}
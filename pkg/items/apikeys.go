@@ -0,0 +1,15 @@
+package items
+
+import "time"
+
+type ApiKey struct {
+	Id       uint64     `json:"id"`
+	Name     string     `json:"name"`
+	Prefix   string     `json:"prefix"`
+	Scopes   []string   `json:"scopes"`
+	Created  *time.Time `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	// full key, returned only once at creation
+	Key string `json:"key,omitempty"`
+}
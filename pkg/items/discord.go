@@ -7,6 +7,7 @@ import (
 type DiscordApiUser struct {
 	Id            string
 	Username      string
+	GlobalName    string `json:"global_name"`
 	Discriminator string
 	Locale        string
 	Avatar        string
@@ -16,8 +17,11 @@ type DiscordApiUser struct {
 }
 
 type DiscordAccount struct {
-	Id          uint64
-	UserId      uint64
+	Id     uint64
+	UserId uint64
+	// snowflake id, the stable key of account
+	DiscordId string
+	// display data, changes on renames
 	Username    string
 	ApiResponse DiscordApiUser
 	Created     *time.Time
@@ -25,8 +29,26 @@ type DiscordAccount struct {
 
 	// token info
 
-	AccessToken    string
-	TokenType      string
-	TokenExpiresIn time.Time
-	RefreshToken   string
+	AccessToken    string    `json:"-"`
+	TokenType      string    `json:"-"`
+	TokenExpiresIn time.Time `json:"-"`
+	RefreshToken   string    `json:"-"`
+	// refresh failed, user has to log in with discord again
+	ReauthRequired bool
+}
+
+type DiscordUsernameChange struct {
+	OldUsername string     `json:"old_username"`
+	NewUsername string     `json:"new_username"`
+	Changed     *time.Time `json:"changed"`
+}
+
+// Membership of discord account in a tracked guild
+type DiscordGuildMember struct {
+	AccountId uint64     `json:"account_id"`
+	GuildId   string     `json:"guild_id"`
+	Roles     []string   `json:"roles"`
+	Nick      string     `json:"nick,omitempty"`
+	JoinedAt  *time.Time `json:"joined_at,omitempty"`
+	Synced    *time.Time `json:"synced"`
 }
@@ -0,0 +1,92 @@
+package items
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type FrontierCommander struct {
+	Id            int64          `json:"id"`
+	Name          string         `json:"name"`
+	Credits       int64          `json:"credits"`
+	Debt          int64          `json:"debt"`
+	CurrentShipId int            `json:"currentShipId"`
+	Alive         bool           `json:"alive"`
+	Docked        bool           `json:"docked"`
+	Rank          map[string]int `json:"rank"`
+}
+
+type FrontierPlace struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type FrontierShip struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	ShipName string `json:"shipName"`
+	ShipID   string `json:"shipID"`
+}
+
+type FrontierSquadron struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	Rank int    `json:"rank"`
+}
+
+// Part of CAPI /profile response kept as structured data
+type FrontierProfile struct {
+	Commander    FrontierCommander `json:"commander"`
+	LastSystem   *FrontierPlace    `json:"lastSystem"`
+	LastStarport *FrontierPlace    `json:"lastStarport"`
+	Ship         *FrontierShip     `json:"ship"`
+	Squadron     *FrontierSquadron `json:"squadron"`
+}
+
+type FrontierAccount struct {
+	Id     uint64
+	UserId uint64
+	// commander name, the key of account
+	Cmdr string
+	// raw CAPI /profile response
+	CapiResponse json.RawMessage
+	Created      *time.Time
+	Updated      *time.Time
+
+	// token info
+
+	AccessToken    string    `json:"-"`
+	TokenType      string    `json:"-"`
+	TokenExpiresIn time.Time `json:"-"`
+	RefreshToken   string    `json:"-"`
+	// refresh failed, user has to log in with frontier again
+	ReauthRequired bool
+	// last synced state of commander
+	Commander *Commander `json:",omitempty"`
+}
+
+// State of commander as of last CAPI sync
+type Commander struct {
+	CommanderId  int64          `json:"commander_id"`
+	Credits      int64          `json:"credits"`
+	Debt         int64          `json:"debt"`
+	Alive        bool           `json:"alive"`
+	Docked       bool           `json:"docked"`
+	System       string         `json:"system,omitempty"`
+	Station      string         `json:"station,omitempty"`
+	ShipId       int            `json:"ship_id,omitempty"`
+	ShipType     string         `json:"ship_type,omitempty"`
+	ShipName     string         `json:"ship_name,omitempty"`
+	ShipIdent    string         `json:"ship_ident,omitempty"`
+	Ranks        map[string]int `json:"ranks"`
+	SquadronId   int64          `json:"squadron_id,omitempty"`
+	SquadronName string         `json:"squadron_name,omitempty"`
+	SquadronTag  string         `json:"squadron_tag,omitempty"`
+	SquadronRank int            `json:"squadron_rank,omitempty"`
+	// CAPI /market and /shipyard of station commander is docked at
+	MarketId int64           `json:"market_id,omitempty"`
+	Market   json.RawMessage `json:"market,omitempty"`
+	Shipyard json.RawMessage `json:"shipyard,omitempty"`
+	Synced   *time.Time      `json:"synced"`
+}
@@ -0,0 +1,27 @@
+package items
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event of Elite Dangerous player journal
+type JournalEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Event     string    `json:"event"`
+	// whole journal line
+	Data json.RawMessage `json:"data"`
+}
+
+// Line of journal batch which was not stored
+type JournalRejection struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type JournalResult struct {
+	Cmdr       string              `json:"cmdr"`
+	Accepted   int                 `json:"accepted"`
+	Duplicates int                 `json:"duplicates"`
+	Rejected   []*JournalRejection `json:"rejected"`
+}
@@ -0,0 +1,36 @@
+package items
+
+import "time"
+
+var (
+	RuleEffectAdmin = "admin"
+	RuleEffectState = "state"
+)
+
+// Rule mapping discord guild roles to principal permissions
+type RoleRule struct {
+	Id      uint64 `json:"id"`
+	GuildId string `json:"guild_id"`
+	// role to match, empty matches any member of guild
+	RoleId string `json:"role_id,omitempty"`
+	// match users who are not members of guild instead
+	Absent bool `json:"absent"`
+	// admin or state
+	Effect string `json:"effect"`
+	// state to set, for state effect
+	State string `json:"state,omitempty"`
+	// rules with lower priority are checked first
+	Priority int        `json:"priority"`
+	Created  *time.Time `json:"created"`
+}
+
+// Change of principal made by role rules
+type PrincipalChange struct {
+	PrincipalId uint64     `json:"principal_id"`
+	UserId      uint64     `json:"user_id,omitempty"`
+	Field       string     `json:"field"`
+	OldValue    string     `json:"old_value"`
+	NewValue    string     `json:"new_value"`
+	RuleId      *uint64    `json:"rule_id,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+}
@@ -0,0 +1,29 @@
+package items
+
+import "time"
+
+type TokenPair struct {
+	AccessToken  string     `json:"token"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Expires      *time.Time `json:"expires,omitempty"`
+}
+
+// Client that requested a token
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	// login provider: discord, etc.
+	Provider string
+}
+
+type Session struct {
+	Id        uint64     `json:"id"`
+	Created   *time.Time `json:"created"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	IP        string     `json:"ip,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	Provider  string     `json:"provider,omitempty"`
+	// session of the token used for request
+	Current bool `json:"current"`
+}
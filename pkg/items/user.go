@@ -1,9 +1,35 @@
 package items
 
 type User struct {
-	Id        uint64          `json:"id"`
-	Principal *Principal      `json:"principal,omitempty"`
-	Discord   *DiscordAccount `json:"discord,omitempty"`
+	Id        uint64           `json:"id"`
+	Principal *Principal       `json:"principal,omitempty"`
+	Discord   *DiscordAccount  `json:"discord,omitempty"`
+	Frontier  *FrontierAccount `json:"frontier,omitempty"`
+	// memberships of linked discord accounts in tracked guilds
+	Guilds []*DiscordGuildMember `json:"guilds,omitempty"`
+}
+
+func (u *User) IsGuildMember(guild string) bool {
+	for _, m := range u.Guilds {
+		if m.GuildId == guild {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) HasGuildRole(guild string, role string) bool {
+	for _, m := range u.Guilds {
+		if m.GuildId != guild {
+			continue
+		}
+		for _, r := range m.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 var (
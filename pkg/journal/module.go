@@ -0,0 +1,108 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var MODULE_NAME = "journal"
+
+// Limits of one uploaded batch
+const (
+	MAX_BATCH_LINES = 1000
+	MAX_LINE_SIZE   = 64 * 1024
+)
+
+var (
+	ErrBatchTooLarge = errors.New("journal batch too large")
+	ErrNoCommander   = errors.New("no frontier account linked for commander")
+	ErrCmdrRequired  = errors.New("several commanders linked, specify cmdr")
+)
+
+func NewJournalModule() *JournalModule {
+	return &JournalModule{}
+}
+
+// Stores journal events uploaded by commanders
+type JournalModule struct {
+}
+
+func (m *JournalModule) Start(ctx context.Context) error {
+	return nil
+}
+
+// Validate batch of journal lines and store events of commander cmdr.
+// Invalid lines and events of other commanders are rejected one by one,
+// already stored events are counted as duplicates.
+func (m *JournalModule) Ingest(ctx context.Context, accountId uint64, cmdr string, r io.Reader, tx pgx.Tx) (*items.JournalResult, error) {
+	ctx, span := tracer.NewSpan(ctx, "journal.ingest", nil)
+	defer span.End()
+	result := &items.JournalResult{
+		Cmdr:     cmdr,
+		Rejected: make([]*items.JournalRejection, 0),
+	}
+	reject := func(line int, err error) {
+		result.Rejected = append(result.Rejected, &items.JournalRejection{
+			Line:  line,
+			Error: err.Error(),
+		})
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MAX_LINE_SIZE)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if n > MAX_BATCH_LINES {
+			return nil, fmt.Errorf("%w: more than %d lines", ErrBatchTooLarge, MAX_BATCH_LINES)
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		ev, err := Validate(append([]byte(nil), line...))
+		if err != nil {
+			reject(n, err)
+			continue
+		}
+		if named := commanderOf(ev); named != "" && !strings.EqualFold(named, cmdr) {
+			reject(n, fmt.Errorf("event of another commander %s", named))
+			continue
+		}
+		tag, err := tx.Exec(ctx, `
+		INSERT INTO journal_events (
+			account_id, cmdr, timestamp, event, data, received
+		) VALUES ($1, $2, $3, $4, $5, now())
+		ON CONFLICT (cmdr, timestamp, event) DO NOTHING
+		`, accountId, cmdr, ev.Timestamp, ev.Event, ev.Data)
+		if err != nil {
+			return nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			result.Duplicates++
+		} else {
+			result.Accepted++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: line %d is longer than %d bytes", ErrBatchTooLarge, n+1, MAX_LINE_SIZE)
+		}
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int("journal.accepted", result.Accepted),
+		attribute.Int("journal.duplicates", result.Duplicates),
+		attribute.Int("journal.rejected", len(result.Rejected)),
+	)
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindNumber
+	kindBool
+	kindArray
+	kindObject
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindString:
+		return "string"
+	case kindNumber:
+		return "number"
+	case kindBool:
+		return "boolean"
+	case kindArray:
+		return "array"
+	}
+	return "object"
+}
+
+type field struct {
+	name string
+	kind kind
+}
+
+var location = []field{
+	{"StarSystem", kindString},
+	{"SystemAddress", kindNumber},
+	{"StarPos", kindArray},
+}
+
+// Fields required by events used downstream. Other events
+// only need timestamp and event name.
+var schemas = map[string][]field{
+	"Commander":   {{"Name", kindString}, {"FID", kindString}},
+	"LoadGame":    {{"Commander", kindString}, {"FID", kindString}},
+	"FSDJump":     location,
+	"Location":    location,
+	"CarrierJump": location,
+	"Docked": {
+		{"StationName", kindString},
+		{"StarSystem", kindString},
+		{"MarketID", kindNumber},
+	},
+	"Undocked": {{"StationName", kindString}},
+	"MissionAccepted": {
+		{"Name", kindString},
+		{"MissionID", kindNumber},
+		{"Faction", kindString},
+	},
+	"MissionCompleted": {
+		{"Name", kindString},
+		{"MissionID", kindNumber},
+		{"Faction", kindString},
+	},
+	"MarketBuy": {
+		{"MarketID", kindNumber},
+		{"Type", kindString},
+		{"Count", kindNumber},
+		{"BuyPrice", kindNumber},
+	},
+	"MarketSell": {
+		{"MarketID", kindNumber},
+		{"Type", kindString},
+		{"Count", kindNumber},
+		{"SellPrice", kindNumber},
+	},
+	"RedeemVoucher":            {{"Type", kindString}, {"Amount", kindNumber}},
+	"FactionKillBond":          {{"Reward", kindNumber}, {"AwardingFaction", kindString}},
+	"SellExplorationData":      {{"TotalEarnings", kindNumber}},
+	"MultiSellExplorationData": {{"TotalEarnings", kindNumber}},
+}
+
+func kindOf(v interface{}) kind {
+	switch v.(type) {
+	case string:
+		return kindString
+	case float64:
+		return kindNumber
+	case bool:
+		return kindBool
+	case []interface{}:
+		return kindArray
+	}
+	return kindObject
+}
+
+// Check journal line against schema of its event.
+func Validate(line []byte) (*items.JournalEvent, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(line, &obj); err != nil {
+		return nil, fmt.Errorf("not a json object: %w", err)
+	}
+	event, ok := obj["event"].(string)
+	if !ok || event == "" {
+		return nil, fmt.Errorf("event is missing")
+	}
+	raw, ok := obj["timestamp"].(string)
+	if !ok {
+		return nil, fmt.Errorf("timestamp is missing")
+	}
+	ts, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	for _, f := range schemas[event] {
+		v, ok := obj[f.name]
+		if !ok || v == nil {
+			return nil, fmt.Errorf("%s: %s is missing", event, f.name)
+		}
+		if kindOf(v) != f.kind {
+			return nil, fmt.Errorf("%s: %s must be %s", event, f.name, f.kind)
+		}
+	}
+	return &items.JournalEvent{
+		Timestamp: ts,
+		Event:     event,
+		Data:      line,
+	}, nil
+}
+
+// Commander named by event, empty for events not naming one.
+func commanderOf(ev *items.JournalEvent) string {
+	var named struct {
+		Name      string
+		Commander string
+	}
+	switch ev.Event {
+	case "Commander":
+		json.Unmarshal(ev.Data, &named)
+		return named.Name
+	case "LoadGame":
+		json.Unmarshal(ev.Data, &named)
+		return named.Commander
+	}
+	return ""
+}
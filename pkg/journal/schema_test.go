@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		`{"timestamp": "2022-01-02T03:04:05Z", "event": "FSDJump", "StarSystem": "Sol", "SystemAddress": 10477373803, "StarPos": [0, 0, 0]}`,
+		`{"timestamp": "2022-01-02T03:04:05Z", "event": "Music", "MusicTrack": "NoTrack"}`,
+	}
+	for _, line := range valid {
+		ev, err := Validate([]byte(line))
+		if err != nil {
+			t.Errorf("%s: %s", line, err)
+			continue
+		}
+		if ev.Timestamp.Year() != 2022 || ev.Event == "" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+	invalid := []string{
+		`not json`,
+		`{"timestamp": "2022-01-02T03:04:05Z"}`,
+		`{"event": "Music"}`,
+		`{"timestamp": "yesterday", "event": "Music"}`,
+		`{"timestamp": "2022-01-02T03:04:05Z", "event": "FSDJump", "StarSystem": "Sol", "StarPos": [0, 0, 0]}`,
+		`{"timestamp": "2022-01-02T03:04:05Z", "event": "Docked", "StationName": "Abraham Lincoln", "StarSystem": "Sol", "MarketID": "128016640"}`,
+	}
+	for _, line := range invalid {
+		if _, err := Validate([]byte(line)); err == nil {
+			t.Errorf("%s: accepted", line)
+		}
+	}
+}
+
+func TestCommanderOf(t *testing.T) {
+	ev, err := Validate([]byte(`{"timestamp": "2022-01-02T03:04:05Z", "event": "Commander", "FID": "F1234", "Name": "Jameson"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := commanderOf(ev); name != "Jameson" {
+		t.Errorf("unexpected commander %s", name)
+	}
+	ev, err = Validate([]byte(`{"timestamp": "2022-01-02T03:04:05Z", "event": "Music", "MusicTrack": "NoTrack"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := commanderOf(ev); name != "" {
+		t.Errorf("unexpected commander %s", name)
+	}
+}
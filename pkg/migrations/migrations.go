@@ -0,0 +1,307 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Key of the postgres advisory lock held while migrating,
+// so several replicas can start at once.
+const LOCK_KEY = 0x63656363
+
+// Databases set up by hand before migrations existed already have
+// the schema of this migration, it is recorded without running.
+const LEGACY_VERSION = 1
+
+type Migration struct {
+	Version  uint64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Migration *Migration
+	AppliedOn *time.Time
+}
+
+func NewMigrator(db *pgxpool.Pool) (*Migrator, error) {
+	list, err := Load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: list,
+	}, nil
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []*Migration
+}
+
+// Read migrations from fsys. Files are named like 0001_name.up.sql
+// and 0001_name.down.sql, both halves are required.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	names, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint64]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction", base)
+		}
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		parts := strings.SplitN(stem, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: invalid name", base)
+		}
+		version, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", base, err)
+		}
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %v: name mismatch %s and %s", version, m.Name, parts[1])
+		}
+		if direction == "up" {
+			m.Up = string(raw)
+			sum := sha256.Sum256(raw)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(raw)
+		}
+	}
+	out := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v: both up and down are required", m.Version)
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Version < out[j].Version
+	})
+	return out, nil
+}
+
+// Apply every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	ctx, span := tracer.NewSpan(ctx, "migrations.up", nil)
+	defer span.End()
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			if err = m.adopt(ctx, conn, applied); err != nil {
+				return fmt.Errorf("migration %v: %w", LEGACY_VERSION, err)
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			log.Printf("applying migration %04d_%s\n", mig.Version, mig.Name)
+			err = m.run(ctx, conn, mig.Up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `
+				INSERT INTO schema_migrations (version, name, checksum, applied_on)
+				VALUES ($1, $2, $3, now())
+				`, mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				tracer.AddSpanError(span, err)
+				tracer.FailSpan(span, "migration failed")
+				return fmt.Errorf("migration %v: %w", mig.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Revert last n applied migrations. n < 0 reverts everything.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	ctx, span := tracer.NewSpan(ctx, "migrations.down", nil)
+	defer span.End()
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && n != 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			log.Printf("reverting migration %04d_%s\n", mig.Version, mig.Name)
+			err = m.run(ctx, conn, mig.Down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `
+				DELETE FROM schema_migrations WHERE version = $1
+				`, mig.Version)
+				return err
+			})
+			if err != nil {
+				tracer.AddSpanError(span, err)
+				tracer.FailSpan(span, "migration failed")
+				return fmt.Errorf("migration %v: %w", mig.Version, err)
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Return every known migration with the time it was applied, if any.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	out := make([]*Status, 0, len(m.migrations))
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			st := &Status{Migration: mig}
+			if on, ok := applied[mig.Version]; ok {
+				st.AppliedOn = on
+			}
+			out = append(out, st)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (m *Migrator) locked(ctx context.Context, f func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, LOCK_KEY)
+	if err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, LOCK_KEY)
+	_, err = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_on TIMESTAMP WITH TIME ZONE NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+// Return applied versions, verifying checksums of known migrations.
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[uint64]*time.Time, error) {
+	known := map[uint64]*Migration{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	out := map[uint64]*time.Time{}
+	rows, err := conn.Query(ctx, `
+	SELECT version, checksum, applied_on FROM schema_migrations
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version uint64
+		var checksum string
+		var on time.Time
+		if err := rows.Scan(&version, &checksum, &on); err != nil {
+			return nil, err
+		}
+		mig, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("migration %v is applied but unknown", version)
+		}
+		if mig.Checksum != checksum {
+			return nil, fmt.Errorf("migration %v: checksum mismatch", version)
+		}
+		out[version] = &on
+	}
+	return out, rows.Err()
+}
+
+// Record the legacy migration as applied when its tables already exist.
+func (m *Migrator) adopt(ctx context.Context, conn *pgxpool.Conn, applied map[uint64]*time.Time) error {
+	var legacy bool
+	err := conn.QueryRow(ctx, `SELECT to_regclass('principals') IS NOT NULL`).Scan(&legacy)
+	if err != nil || !legacy {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if mig.Version != LEGACY_VERSION {
+			continue
+		}
+		log.Printf("adopting existing schema as migration %04d_%s\n", mig.Version, mig.Name)
+		var on time.Time
+		err = conn.QueryRow(ctx, `
+		INSERT INTO schema_migrations (version, name, checksum, applied_on)
+		VALUES ($1, $2, $3, now())
+		RETURNING applied_on
+		`, mig.Version, mig.Name, mig.Checksum).Scan(&on)
+		if err != nil {
+			return err
+		}
+		applied[mig.Version] = &on
+	}
+	return nil
+}
+
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, stmt string, record func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, stmt); err != nil {
+		return err
+	}
+	if err = record(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
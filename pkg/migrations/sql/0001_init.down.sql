@@ -0,0 +1,5 @@
+DROP TABLE frontier_accounts;
+DROP TABLE discord_accounts;
+DROP TABLE access_tokens;
+DROP TABLE users;
+DROP TABLE principals;
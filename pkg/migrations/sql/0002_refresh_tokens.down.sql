@@ -0,0 +1,6 @@
+DROP INDEX access_tokens_token;
+DROP TABLE refresh_tokens;
+DROP SEQUENCE refresh_token_families;
+ALTER TABLE access_tokens DROP COLUMN family;
+ALTER TABLE access_tokens DROP COLUMN created;
+ALTER TABLE access_tokens DROP COLUMN id;
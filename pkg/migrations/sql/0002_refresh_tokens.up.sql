@@ -0,0 +1,18 @@
+ALTER TABLE access_tokens ADD COLUMN id BIGSERIAL NOT NULL PRIMARY KEY;
+ALTER TABLE access_tokens ADD COLUMN created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+ALTER TABLE access_tokens ADD COLUMN family BIGINT;
+
+CREATE SEQUENCE refresh_token_families;
+
+CREATE TABLE refresh_tokens (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    principal_id BIGINT NOT NULL REFERENCES principals(id),
+    family BIGINT NOT NULL,
+    token VARCHAR NOT NULL UNIQUE,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    used TIMESTAMP WITH TIME ZONE,
+    revoked TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX refresh_tokens_family ON refresh_tokens(family);
+CREATE INDEX access_tokens_token ON access_tokens(token);
@@ -0,0 +1,4 @@
+DROP INDEX access_tokens_principal;
+ALTER TABLE refresh_tokens DROP COLUMN revoke_reason;
+ALTER TABLE access_tokens DROP COLUMN revoke_reason;
+ALTER TABLE access_tokens DROP COLUMN revoked;
@@ -0,0 +1,4 @@
+ALTER TABLE access_tokens ADD COLUMN revoked TIMESTAMP WITH TIME ZONE;
+ALTER TABLE access_tokens ADD COLUMN revoke_reason VARCHAR(32);
+ALTER TABLE refresh_tokens ADD COLUMN revoke_reason VARCHAR(32);
+CREATE INDEX access_tokens_principal ON access_tokens(principal_id);
@@ -0,0 +1,13 @@
+-- hashed tokens cannot be restored, their sessions are dropped
+DELETE FROM refresh_tokens WHERE token IS NULL;
+DROP INDEX refresh_tokens_token_hash;
+ALTER TABLE refresh_tokens ALTER COLUMN token SET NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN key_id;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+
+DELETE FROM access_tokens WHERE token IS NULL;
+CREATE INDEX access_tokens_token ON access_tokens(token);
+DROP INDEX access_tokens_token_hash;
+ALTER TABLE access_tokens ALTER COLUMN token SET NOT NULL;
+ALTER TABLE access_tokens DROP COLUMN key_id;
+ALTER TABLE access_tokens DROP COLUMN token_hash;
@@ -0,0 +1,10 @@
+ALTER TABLE access_tokens ADD COLUMN token_hash VARCHAR(64);
+ALTER TABLE access_tokens ADD COLUMN key_id VARCHAR(32);
+ALTER TABLE access_tokens ALTER COLUMN token DROP NOT NULL;
+CREATE UNIQUE INDEX access_tokens_token_hash ON access_tokens(token_hash);
+DROP INDEX access_tokens_token;
+
+ALTER TABLE refresh_tokens ADD COLUMN token_hash VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN key_id VARCHAR(32);
+ALTER TABLE refresh_tokens ALTER COLUMN token DROP NOT NULL;
+CREATE UNIQUE INDEX refresh_tokens_token_hash ON refresh_tokens(token_hash);
@@ -0,0 +1,4 @@
+ALTER TABLE access_tokens DROP COLUMN provider;
+ALTER TABLE access_tokens DROP COLUMN user_agent;
+ALTER TABLE access_tokens DROP COLUMN ip;
+ALTER TABLE access_tokens DROP COLUMN last_used;
@@ -0,0 +1,4 @@
+ALTER TABLE access_tokens ADD COLUMN last_used TIMESTAMP WITH TIME ZONE;
+ALTER TABLE access_tokens ADD COLUMN ip VARCHAR(64);
+ALTER TABLE access_tokens ADD COLUMN user_agent VARCHAR(512);
+ALTER TABLE access_tokens ADD COLUMN provider VARCHAR(16);
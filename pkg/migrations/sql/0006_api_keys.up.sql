@@ -0,0 +1,14 @@
+CREATE TABLE api_keys (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    principal_id BIGINT NOT NULL REFERENCES principals(id),
+    name VARCHAR(64) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    key_id VARCHAR(32) NOT NULL,
+    scopes VARCHAR(32)[] NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires TIMESTAMP WITH TIME ZONE,
+    last_used TIMESTAMP WITH TIME ZONE,
+    revoked TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX api_keys_principal ON api_keys(principal_id);
@@ -0,0 +1,2 @@
+DROP INDEX discord_accounts_token_expires;
+ALTER TABLE discord_accounts DROP COLUMN reauth_required;
@@ -0,0 +1,2 @@
+ALTER TABLE discord_accounts ADD COLUMN reauth_required BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX discord_accounts_token_expires ON discord_accounts(token_expires_in) WHERE NOT reauth_required;
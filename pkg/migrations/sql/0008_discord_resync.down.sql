@@ -0,0 +1,2 @@
+DROP TABLE discord_username_history;
+ALTER TABLE discord_accounts DROP COLUMN synced;
@@ -0,0 +1,10 @@
+ALTER TABLE discord_accounts ADD COLUMN synced TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE discord_username_history (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES discord_accounts(id) ON DELETE CASCADE,
+    old_username VARCHAR(64) NOT NULL,
+    new_username VARCHAR(64) NOT NULL,
+    changed TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX discord_username_history_account ON discord_username_history(account_id);
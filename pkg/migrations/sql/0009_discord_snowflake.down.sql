@@ -0,0 +1,9 @@
+DROP TABLE discord_orphaned_users;
+-- usernames of new style accounts may clash, keep the freshest one
+DELETE FROM discord_accounts d
+USING discord_accounts newer
+WHERE d.username = newer.username
+AND (d.updated, d.id) < (newer.updated, newer.id);
+ALTER TABLE discord_accounts ADD CONSTRAINT discord_accounts_username_key UNIQUE (username);
+ALTER TABLE discord_accounts DROP CONSTRAINT discord_accounts_discord_id_key;
+ALTER TABLE discord_accounts DROP COLUMN discord_id;
@@ -0,0 +1,53 @@
+ALTER TABLE discord_accounts ADD COLUMN discord_id VARCHAR(32);
+UPDATE discord_accounts SET discord_id = COALESCE(api_response->>'Id', api_response->>'id');
+-- accounts without id cannot be matched on login, they are recreated on next one
+DELETE FROM discord_accounts WHERE discord_id IS NULL OR discord_id = '';
+ALTER TABLE discord_accounts DROP CONSTRAINT discord_accounts_username_key;
+-- renames used to create a duplicate account owned by a fresh user. The oldest
+-- account belongs to the original user, which holds the state and history:
+-- it is kept with name and tokens of the freshest one, the others are dropped.
+-- Users left behind are recorded for admins to merge.
+CREATE TABLE discord_orphaned_users (
+    user_id BIGINT NOT NULL PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    discord_id VARCHAR(32) NOT NULL,
+    kept_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recorded TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE TEMPORARY TABLE discord_duplicates ON COMMIT DROP AS
+SELECT DISTINCT
+    discord_id,
+    first_value(id) OVER (PARTITION BY discord_id ORDER BY created, id) AS kept_id,
+    first_value(id) OVER (PARTITION BY discord_id ORDER BY updated DESC, id DESC) AS freshest_id
+FROM discord_accounts
+WHERE discord_id IN (
+    SELECT discord_id FROM discord_accounts GROUP BY discord_id HAVING count(*) > 1
+);
+UPDATE discord_accounts kept SET
+    username = fresh.username,
+    api_response = fresh.api_response,
+    updated = fresh.updated,
+    synced = fresh.synced,
+    access_token = fresh.access_token,
+    token_type = fresh.token_type,
+    token_expires_in = fresh.token_expires_in,
+    refresh_token = fresh.refresh_token,
+    reauth_required = fresh.reauth_required
+FROM discord_duplicates dup
+JOIN discord_accounts fresh ON fresh.id = dup.freshest_id
+WHERE kept.id = dup.kept_id AND dup.freshest_id <> dup.kept_id;
+UPDATE discord_username_history h SET account_id = dup.kept_id
+FROM discord_accounts d
+JOIN discord_duplicates dup ON dup.discord_id = d.discord_id
+WHERE h.account_id = d.id AND d.id <> dup.kept_id;
+INSERT INTO discord_orphaned_users (user_id, discord_id, kept_user_id, recorded)
+SELECT DISTINCT ON (d.user_id) d.user_id, d.discord_id, kept.user_id, now()
+FROM discord_accounts d
+JOIN discord_duplicates dup ON dup.discord_id = d.discord_id
+JOIN discord_accounts kept ON kept.id = dup.kept_id
+WHERE d.id <> dup.kept_id AND d.user_id <> kept.user_id
+ORDER BY d.user_id, d.id;
+DELETE FROM discord_accounts d
+USING discord_duplicates dup
+WHERE d.discord_id = dup.discord_id AND d.id <> dup.kept_id;
+ALTER TABLE discord_accounts ALTER COLUMN discord_id SET NOT NULL;
+ALTER TABLE discord_accounts ADD CONSTRAINT discord_accounts_discord_id_key UNIQUE (discord_id);
@@ -0,0 +1,9 @@
+CREATE TABLE discord_guild_members (
+    account_id BIGINT NOT NULL REFERENCES discord_accounts(id) ON DELETE CASCADE,
+    guild_id VARCHAR(32) NOT NULL,
+    roles VARCHAR(32)[] NOT NULL,
+    nick VARCHAR(64),
+    joined_at TIMESTAMP WITH TIME ZONE,
+    synced TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (account_id, guild_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE principal_audit;
+ALTER TABLE principals DROP COLUMN admin_by_rule;
+DROP TABLE role_rules;
@@ -0,0 +1,23 @@
+CREATE TABLE role_rules (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    guild_id VARCHAR(32) NOT NULL,
+    role_id VARCHAR(32),
+    absent BOOLEAN NOT NULL DEFAULT false,
+    effect VARCHAR(16) NOT NULL,
+    state VARCHAR(16),
+    priority INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE principals ADD COLUMN admin_by_rule BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE principal_audit (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    principal_id BIGINT NOT NULL REFERENCES principals(id) ON DELETE CASCADE,
+    field VARCHAR(16) NOT NULL,
+    old_value VARCHAR(32) NOT NULL,
+    new_value VARCHAR(32) NOT NULL,
+    rule_id BIGINT REFERENCES role_rules(id) ON DELETE SET NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX principal_audit_principal ON principal_audit(principal_id);
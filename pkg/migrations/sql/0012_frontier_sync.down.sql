@@ -0,0 +1,3 @@
+DROP TABLE frontier_commanders;
+ALTER TABLE frontier_accounts DROP COLUMN synced;
+ALTER TABLE frontier_accounts DROP COLUMN reauth_required;
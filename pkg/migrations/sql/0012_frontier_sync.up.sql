@@ -0,0 +1,27 @@
+ALTER TABLE frontier_accounts ADD COLUMN reauth_required BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE frontier_accounts ADD COLUMN synced TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE frontier_commanders (
+    account_id BIGINT NOT NULL PRIMARY KEY REFERENCES frontier_accounts(id) ON DELETE CASCADE,
+    commander_id BIGINT NOT NULL,
+    credits BIGINT NOT NULL,
+    debt BIGINT NOT NULL,
+    alive BOOLEAN NOT NULL,
+    docked BOOLEAN NOT NULL,
+    system_name VARCHAR(64),
+    station_name VARCHAR(64),
+    ship_id INTEGER,
+    ship_type VARCHAR(64),
+    ship_name VARCHAR(64),
+    ship_ident VARCHAR(16),
+    ranks JSONB NOT NULL,
+    squadron_id BIGINT,
+    squadron_name VARCHAR(64),
+    squadron_tag VARCHAR(8),
+    squadron_rank INTEGER,
+    market_id BIGINT,
+    market JSONB,
+    shipyard JSONB,
+    synced TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX frontier_commanders_squadron ON frontier_commanders(squadron_id);
@@ -0,0 +1,12 @@
+CREATE TABLE journal_events (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES frontier_accounts(id) ON DELETE CASCADE,
+    cmdr VARCHAR(64) NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    data JSONB NOT NULL,
+    received TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (cmdr, timestamp, event)
+);
+CREATE INDEX journal_events_account ON journal_events(account_id, timestamp);
+CREATE INDEX journal_events_event ON journal_events(event, timestamp);
@@ -0,0 +1 @@
+DROP TABLE game_factions;
@@ -0,0 +1,11 @@
+CREATE TABLE game_factions (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    allegiance VARCHAR(32) NOT NULL,
+    government VARCHAR(32) NOT NULL,
+    home_system VARCHAR(64),
+    squadron_supported BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE UNIQUE INDEX game_factions_name ON game_factions(lower(name));
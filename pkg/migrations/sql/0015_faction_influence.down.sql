@@ -0,0 +1 @@
+DROP TABLE faction_influence;
@@ -0,0 +1,15 @@
+CREATE TABLE faction_influence (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    faction_id BIGINT NOT NULL REFERENCES game_factions(id) ON DELETE CASCADE,
+    system VARCHAR(64) NOT NULL,
+    tick TIMESTAMP WITH TIME ZONE NOT NULL,
+    influence DOUBLE PRECISION NOT NULL,
+    happiness VARCHAR(32),
+    active_states VARCHAR(32)[] NOT NULL DEFAULT '{}',
+    pending_states VARCHAR(32)[] NOT NULL DEFAULT '{}',
+    recovering_states VARCHAR(32)[] NOT NULL DEFAULT '{}',
+    submitted_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (faction_id, system, tick)
+);
+CREATE INDEX faction_influence_tick ON faction_influence(faction_id, tick);
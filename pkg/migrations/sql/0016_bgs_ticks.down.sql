@@ -0,0 +1 @@
+DROP TABLE bgs_ticks;
@@ -0,0 +1,6 @@
+CREATE TABLE bgs_ticks (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    time TIMESTAMP WITH TIME ZONE NOT NULL UNIQUE,
+    systems INTEGER NOT NULL,
+    detected TIMESTAMP WITH TIME ZONE NOT NULL
+);
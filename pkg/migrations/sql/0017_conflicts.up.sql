@@ -0,0 +1,22 @@
+CREATE TABLE faction_conflicts (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    system VARCHAR(64) NOT NULL,
+    war_type VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    faction1_id BIGINT REFERENCES game_factions(id) ON DELETE SET NULL,
+    faction1_name VARCHAR(128) NOT NULL,
+    faction1_stake VARCHAR(128),
+    faction1_days INTEGER NOT NULL DEFAULT 0,
+    faction2_id BIGINT REFERENCES game_factions(id) ON DELETE SET NULL,
+    faction2_name VARCHAR(128) NOT NULL,
+    faction2_stake VARCHAR(128),
+    faction2_days INTEGER NOT NULL DEFAULT 0,
+    outcome VARCHAR(128),
+    manual BOOLEAN NOT NULL DEFAULT false,
+    started TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX faction_conflicts_system ON faction_conflicts(lower(system)) WHERE status <> 'ended';
+CREATE INDEX faction_conflicts_faction1 ON faction_conflicts(faction1_id);
+CREATE INDEX faction_conflicts_faction2 ON faction_conflicts(faction2_id);
@@ -0,0 +1,2 @@
+DROP TABLE op_signups;
+DROP TABLE ops;
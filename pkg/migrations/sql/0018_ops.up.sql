@@ -0,0 +1,31 @@
+CREATE TABLE ops (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    title VARCHAR(128) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    faction_id BIGINT REFERENCES game_factions(id) ON DELETE SET NULL,
+    system VARCHAR(64),
+    objective TEXT NOT NULL,
+    starts TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends TIMESTAMP WITH TIME ZONE NOT NULL,
+    capacity INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    reminded TIMESTAMP WITH TIME ZONE,
+    outcome VARCHAR(16),
+    report TEXT,
+    reported_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    completed TIMESTAMP WITH TIME ZONE,
+    CHECK (ends > starts)
+);
+CREATE INDEX ops_starts ON ops(starts);
+
+CREATE TABLE op_signups (
+    op_id BIGINT NOT NULL REFERENCES ops(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    attended BOOLEAN,
+    PRIMARY KEY (op_id, user_id)
+);
+CREATE INDEX op_signups_user ON op_signups(user_id);
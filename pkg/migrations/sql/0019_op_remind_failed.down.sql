@@ -0,0 +1 @@
+ALTER TABLE ops DROP COLUMN remind_failed;
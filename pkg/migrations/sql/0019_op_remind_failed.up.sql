@@ -0,0 +1 @@
+ALTER TABLE ops ADD COLUMN remind_failed TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+ALTER TABLE discord_accounts DROP COLUMN refresh_attempted;
@@ -0,0 +1 @@
+ALTER TABLE discord_accounts ADD COLUMN refresh_attempted TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+ALTER TABLE frontier_accounts DROP COLUMN refresh_attempted;
@@ -0,0 +1,2 @@
+DROP INDEX faction_influence_system_tick;
+ALTER TABLE faction_influence ADD CONSTRAINT faction_influence_faction_id_system_tick_key UNIQUE (faction_id, system, tick);
@@ -0,0 +1,22 @@
+ALTER TABLE faction_influence DROP CONSTRAINT faction_influence_faction_id_system_tick_key;
+
+-- keep the first recorded spelling of every system
+UPDATE faction_influence f SET system = first.system
+FROM (
+    SELECT DISTINCT ON (faction_id, lower(system)) faction_id, system
+    FROM faction_influence
+    ORDER BY faction_id, lower(system), id
+) first
+WHERE f.faction_id = first.faction_id
+AND lower(f.system) = lower(first.system)
+AND f.system <> first.system;
+
+-- snapshots which differed only by case, the newest one stays
+DELETE FROM faction_influence f
+USING faction_influence newer
+WHERE newer.faction_id = f.faction_id
+AND newer.system = f.system
+AND newer.tick = f.tick
+AND newer.id > f.id;
+
+CREATE UNIQUE INDEX faction_influence_system_tick ON faction_influence(faction_id, lower(system), tick);
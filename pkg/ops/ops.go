@@ -0,0 +1,481 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var MODULE_NAME = "ops"
+
+var (
+	ErrInvalidOp = errors.New("invalid op")
+	ErrOpFull    = errors.New("op is full")
+	// Op was cancelled, completed or is over
+	ErrOpClosed = errors.New("op is closed")
+)
+
+var KINDS = []string{"bgs", "mining", "combat"}
+
+const (
+	STATUS_SCHEDULED = "scheduled"
+	STATUS_CANCELLED = "cancelled"
+	STATUS_COMPLETED = "completed"
+)
+
+var OUTCOMES = []string{"success", "partial", "failed"}
+
+// Length limits of op fields, reminders have to fit into one Discord message
+const (
+	MAX_TITLE     = 128
+	MAX_SYSTEM    = 64
+	MAX_OBJECTIVE = 1500
+)
+
+// Squadron operation members sign up for
+type Op struct {
+	Id    uint64 `json:"id"`
+	Title string `json:"title"`
+	// bgs, mining or combat
+	Kind      string    `json:"kind"`
+	FactionId *uint64   `json:"faction_id,omitempty"`
+	System    string    `json:"system,omitempty"`
+	Objective string    `json:"objective"`
+	Starts    time.Time `json:"starts"`
+	Ends      time.Time `json:"ends"`
+	// most members who can sign up, 0 for no limit
+	Capacity  int        `json:"capacity"`
+	Status    string     `json:"status"`
+	SignedUp  int        `json:"signed_up"`
+	CreatedBy *uint64    `json:"created_by,omitempty"`
+	Created   *time.Time `json:"created"`
+	Updated   *time.Time `json:"updated"`
+	// when members were reminded of the op
+	Reminded *time.Time `json:"reminded,omitempty"`
+	Report   *Report    `json:"report,omitempty"`
+	// filled when a single op is requested
+	Signups []*Signup `json:"signups,omitempty"`
+}
+
+// Completion report of op
+type Report struct {
+	Outcome    string     `json:"outcome"`
+	Summary    string     `json:"summary"`
+	ReportedBy *uint64    `json:"reported_by,omitempty"`
+	Completed  *time.Time `json:"completed"`
+}
+
+type Signup struct {
+	UserId  uint64    `json:"user_id"`
+	Created time.Time `json:"created"`
+	// set by the completion report
+	Attended *bool `json:"attended,omitempty"`
+}
+
+// Search parameters, zero values match everything
+type Filter struct {
+	Status string
+	// ops ending after this time
+	From   *time.Time
+	Limit  int
+	Offset int
+}
+
+const MAX_LIMIT = 500
+
+type ApiClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+func NewOpsModule(client ApiClient, db *pgxpool.Pool, cfg *config.Config) *OpsModule {
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+	return &OpsModule{
+		client: client,
+		db:     db,
+		config: cfg,
+	}
+}
+
+type OpsModule struct {
+	client ApiClient
+	db     *pgxpool.Pool
+	config *config.Config
+}
+
+func (m *OpsModule) Start(ctx context.Context) error {
+	if m.db != nil && m.config.OpsWebhook != "" && m.config.OpsReminder > 0 {
+		go m.remindLoop(ctx)
+	}
+	return nil
+}
+
+func oneOf(value string, known []string) (string, bool) {
+	for _, k := range known {
+		if strings.EqualFold(k, value) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Check op fields, normalizing case of kind.
+func Validate(op *Op) error {
+	op.Title = strings.TrimSpace(op.Title)
+	op.System = strings.TrimSpace(op.System)
+	op.Objective = strings.TrimSpace(op.Objective)
+	if op.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidOp)
+	}
+	if utf8.RuneCountInString(op.Title) > MAX_TITLE {
+		return fmt.Errorf("%w: title is longer than %d characters", ErrInvalidOp, MAX_TITLE)
+	}
+	if utf8.RuneCountInString(op.System) > MAX_SYSTEM {
+		return fmt.Errorf("%w: system is longer than %d characters", ErrInvalidOp, MAX_SYSTEM)
+	}
+	kind, ok := oneOf(op.Kind, KINDS)
+	if !ok {
+		return fmt.Errorf("%w: unknown kind %s", ErrInvalidOp, op.Kind)
+	}
+	op.Kind = kind
+	if op.Objective == "" {
+		return fmt.Errorf("%w: objective is required", ErrInvalidOp)
+	}
+	if utf8.RuneCountInString(op.Objective) > MAX_OBJECTIVE {
+		return fmt.Errorf("%w: objective is longer than %d characters", ErrInvalidOp, MAX_OBJECTIVE)
+	}
+	if op.Starts.IsZero() || !op.Ends.After(op.Starts) {
+		return fmt.Errorf("%w: op must end after it starts", ErrInvalidOp)
+	}
+	if op.Capacity < 0 {
+		return fmt.Errorf("%w: capacity cannot be negative", ErrInvalidOp)
+	}
+	return nil
+}
+
+// Members can sign up and withdraw until a scheduled op ends.
+func (op *Op) Open(now time.Time) bool {
+	return op.Status == STATUS_SCHEDULED && now.Before(op.Ends)
+}
+
+func (op *Op) Full() bool {
+	return op.Capacity > 0 && op.SignedUp >= op.Capacity
+}
+
+func (m *OpsModule) Create(ctx context.Context, op *Op, tx pgx.Tx) error {
+	if err := Validate(op); err != nil {
+		return err
+	}
+	now := time.Now()
+	op.Status = STATUS_SCHEDULED
+	op.Created, op.Updated = &now, &now
+	return tx.QueryRow(ctx, `
+	INSERT INTO ops (
+		title, kind, faction_id, system, objective, starts, ends,
+		capacity, status, created_by, created, updated
+	) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id
+	`, op.Title, op.Kind, op.FactionId, op.System, op.Objective, op.Starts, op.Ends,
+		op.Capacity, op.Status, op.CreatedBy, op.Created, op.Updated,
+	).Scan(&op.Id)
+}
+
+// Replace fields of scheduled op op.Id. Members are reminded again
+// when the op is moved.
+func (m *OpsModule) Update(ctx context.Context, op *Op, tx pgx.Tx) error {
+	if err := Validate(op); err != nil {
+		return err
+	}
+	stored, err := m.lock(ctx, op.Id, tx)
+	if err != nil {
+		return err
+	}
+	if stored.Status != STATUS_SCHEDULED {
+		return ErrOpClosed
+	}
+	if op.Capacity > 0 && op.Capacity < stored.SignedUp {
+		return fmt.Errorf("%w: %d members already signed up", ErrOpFull, stored.SignedUp)
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE ops SET
+		title = $2,
+		kind = $3,
+		faction_id = $4,
+		system = NULLIF($5, ''),
+		objective = $6,
+		reminded = CASE WHEN starts = $7 THEN reminded END,
+		starts = $7,
+		ends = $8,
+		capacity = $9,
+		updated = now()
+	WHERE id = $1
+	`, op.Id, op.Title, op.Kind, op.FactionId, op.System, op.Objective, op.Starts, op.Ends,
+		op.Capacity)
+	if err != nil {
+		return err
+	}
+	updated, err := m.FindOne(ctx, op.Id, tx)
+	if err != nil {
+		return err
+	}
+	*op = *updated
+	return nil
+}
+
+func (m *OpsModule) Cancel(ctx context.Context, id uint64, tx pgx.Tx) error {
+	op, err := m.lock(ctx, id, tx)
+	if err != nil {
+		return err
+	}
+	if op.Status != STATUS_SCHEDULED {
+		return ErrOpClosed
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE ops SET status = $2, updated = now() WHERE id = $1
+	`, id, STATUS_CANCELLED)
+	return err
+}
+
+// Sign user up for op, signing up twice is not an error.
+func (m *OpsModule) SignUp(ctx context.Context, id uint64, userId uint64, tx pgx.Tx) error {
+	op, err := m.lock(ctx, id, tx)
+	if err != nil {
+		return err
+	}
+	if !op.Open(time.Now()) {
+		return ErrOpClosed
+	}
+	var signed bool
+	err = tx.QueryRow(ctx, `
+	SELECT EXISTS(SELECT 1 FROM op_signups WHERE op_id = $1 AND user_id = $2)
+	`, id, userId).Scan(&signed)
+	if err != nil || signed {
+		return err
+	}
+	if op.Full() {
+		return ErrOpFull
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO op_signups (op_id, user_id, created) VALUES ($1, $2, now())
+	ON CONFLICT DO NOTHING
+	`, id, userId)
+	return err
+}
+
+// Withdraw user from op, pgx.ErrNoRows when user is not signed up.
+func (m *OpsModule) Withdraw(ctx context.Context, id uint64, userId uint64, tx pgx.Tx) error {
+	op, err := m.lock(ctx, id, tx)
+	if err != nil {
+		return err
+	}
+	if !op.Open(time.Now()) {
+		return ErrOpClosed
+	}
+	tag, err := tx.Exec(ctx, `
+	DELETE FROM op_signups WHERE op_id = $1 AND user_id = $2
+	`, id, userId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Complete scheduled op with report, marking which of the
+// signed up members attended.
+func (m *OpsModule) Complete(ctx context.Context, id uint64, report *Report, attended []uint64, tx pgx.Tx) error {
+	outcome, ok := oneOf(report.Outcome, OUTCOMES)
+	if !ok {
+		return fmt.Errorf("%w: unknown outcome %s", ErrInvalidOp, report.Outcome)
+	}
+	report.Outcome = outcome
+	report.Summary = strings.TrimSpace(report.Summary)
+	op, err := m.lock(ctx, id, tx)
+	if err != nil {
+		return err
+	}
+	if op.Status != STATUS_SCHEDULED {
+		return ErrOpClosed
+	}
+	if attended == nil {
+		attended = []uint64{}
+	}
+	var unknown int
+	err = tx.QueryRow(ctx, `
+	SELECT count(*) FROM unnest($2::bigint[]) AS a(user_id)
+	WHERE NOT EXISTS (SELECT 1 FROM op_signups s WHERE s.op_id = $1 AND s.user_id = a.user_id)
+	`, id, attended).Scan(&unknown)
+	if err != nil {
+		return err
+	}
+	if unknown > 0 {
+		return fmt.Errorf("%w: %d attendees did not sign up", ErrInvalidOp, unknown)
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE op_signups SET attended = user_id = ANY($2) WHERE op_id = $1
+	`, id, attended)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(ctx, `
+	UPDATE ops SET
+		status = $2,
+		outcome = $3,
+		report = $4,
+		reported_by = $5,
+		completed = now(),
+		updated = now()
+	WHERE id = $1
+	RETURNING completed
+	`, id, STATUS_COMPLETED, report.Outcome, report.Summary, report.ReportedBy,
+	).Scan(&report.Completed)
+}
+
+const columns = `id, title, kind, faction_id, COALESCE(system, ''), objective,
+	starts, ends, capacity, status, created_by, created, updated, reminded,
+	outcome, COALESCE(report, ''), reported_by, completed`
+
+// Count of signups, to select along with columns
+const signedUp = `(SELECT count(*) FROM op_signups s WHERE s.op_id = ops.id)`
+
+func scan(row pgx.Row) (*Op, error) {
+	op := &Op{}
+	var (
+		outcome *string
+		report  = &Report{}
+	)
+	err := row.Scan(
+		&op.Id,
+		&op.Title,
+		&op.Kind,
+		&op.FactionId,
+		&op.System,
+		&op.Objective,
+		&op.Starts,
+		&op.Ends,
+		&op.Capacity,
+		&op.Status,
+		&op.CreatedBy,
+		&op.Created,
+		&op.Updated,
+		&op.Reminded,
+		&outcome,
+		&report.Summary,
+		&report.ReportedBy,
+		&report.Completed,
+		&op.SignedUp,
+	)
+	if outcome != nil {
+		report.Outcome = *outcome
+		op.Report = report
+	}
+	return op, err
+}
+
+// Lock op for update, with current number of signups. Signups are
+// counted by a separate statement once the lock is held, so the count
+// includes signups of transactions which held the lock before.
+func (m *OpsModule) lock(ctx context.Context, id uint64, tx pgx.Tx) (*Op, error) {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM ops WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.FindOne(ctx, id, tx)
+}
+
+func (m *OpsModule) FindOne(ctx context.Context, id uint64, db api.DbConn) (*Op, error) {
+	return scan(db.QueryRow(ctx, `SELECT `+columns+`, `+signedUp+` FROM ops WHERE id = $1`, id))
+}
+
+// Ops matching filter, ordered by start.
+func (m *OpsModule) Search(ctx context.Context, filter *Filter, db api.DbConn) ([]*Op, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > MAX_LIMIT {
+		limit = MAX_LIMIT
+	}
+	out := make([]*Op, 0)
+	rows, err := db.Query(ctx, `
+	SELECT `+columns+`, `+signedUp+` FROM ops
+	WHERE ($1 = '' OR status = $1)
+	AND ($2::timestamptz IS NULL OR ends > $2)
+	ORDER BY starts, id
+	LIMIT $3 OFFSET $4
+	`, filter.Status, filter.From, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		op, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, op)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Members signed up for op, in order of signing up.
+func (m *OpsModule) Signups(ctx context.Context, id uint64, db api.DbConn) ([]*Signup, error) {
+	out := make([]*Signup, 0)
+	rows, err := db.Query(ctx, `
+	SELECT user_id, created, attended FROM op_signups WHERE op_id = $1 ORDER BY created, user_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := &Signup{}
+		if err = rows.Scan(&s.UserId, &s.Created, &s.Attended); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Ops the user is signed up for, ending after from, ordered by start.
+func (m *OpsModule) UserOps(ctx context.Context, userId uint64, from time.Time, db api.DbConn) ([]*Op, error) {
+	out := make([]*Op, 0)
+	rows, err := db.Query(ctx, `
+	SELECT `+columns+`, `+signedUp+` FROM ops
+	WHERE ends > $2 AND EXISTS (SELECT 1 FROM op_signups s WHERE s.op_id = ops.id AND s.user_id = $1)
+	ORDER BY starts, id
+	`, userId, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		op, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, op)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+)
+
+func TestValidate(t *testing.T) {
+	starts := time.Date(2022, 3, 5, 19, 0, 0, 0, time.UTC)
+	op := &Op{Title: " Jotun push ", Kind: "BGS", Objective: "Missions for CEC", Starts: starts, Ends: starts.Add(2 * time.Hour)}
+	if err := Validate(op); err != nil {
+		t.Fatal(err)
+	}
+	if op.Title != "Jotun push" || op.Kind != "bgs" {
+		t.Errorf("fields are not normalized: %+v", op)
+	}
+	invalid := []*Op{
+		{Kind: "bgs", Objective: "x", Starts: starts, Ends: starts.Add(time.Hour)},
+		{Title: "x", Kind: "racing", Objective: "x", Starts: starts, Ends: starts.Add(time.Hour)},
+		{Title: "x", Kind: "bgs", Starts: starts, Ends: starts.Add(time.Hour)},
+		{Title: "x", Kind: "bgs", Objective: "x", Starts: starts, Ends: starts},
+		{Title: "x", Kind: "bgs", Objective: "x", Ends: starts},
+		{Title: "x", Kind: "bgs", Objective: "x", Starts: starts, Ends: starts.Add(time.Hour), Capacity: -1},
+		{Title: strings.Repeat("x", MAX_TITLE+1), Kind: "bgs", Objective: "x", Starts: starts, Ends: starts.Add(time.Hour)},
+		{Title: "x", Kind: "bgs", System: strings.Repeat("x", MAX_SYSTEM+1), Objective: "x", Starts: starts, Ends: starts.Add(time.Hour)},
+		{Title: "x", Kind: "bgs", Objective: strings.Repeat("x", MAX_OBJECTIVE+1), Starts: starts, Ends: starts.Add(time.Hour)},
+	}
+	for _, op := range invalid {
+		if err := Validate(op); !errors.Is(err, ErrInvalidOp) {
+			t.Errorf("expected ErrInvalidOp for %+v, got %v", op, err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	now := time.Now()
+	op := &Op{Status: STATUS_SCHEDULED, Starts: now.Add(-time.Hour), Ends: now.Add(time.Hour), Capacity: 2, SignedUp: 1}
+	if !op.Open(now) || op.Full() {
+		t.Error("running op with free slots is closed")
+	}
+	if op.SignedUp = 2; !op.Full() {
+		t.Error("op is not full")
+	}
+	if op.Capacity = 0; op.Full() {
+		t.Error("op without capacity is full")
+	}
+	if op.Open(now.Add(2 * time.Hour)) {
+		t.Error("op is open after it ended")
+	}
+	if op.Status = STATUS_CANCELLED; op.Open(now) {
+		t.Error("cancelled op is open")
+	}
+}
+
+func TestReminder(t *testing.T) {
+	starts := time.Date(2022, 3, 5, 19, 0, 0, 0, time.UTC)
+	op := &Op{Title: "Jotun push", Kind: "bgs", System: "Jotun", Objective: "Missions for CEC", Starts: starts}
+	expected := "**Jotun push** (bgs) starts 2022-03-05 19:00 UTC in Jotun\nMissions for CEC\n<@1> <@2>"
+	if msgs := reminders(op, []string{"1", "2"}); len(msgs) != 1 || msgs[0].Content != expected {
+		t.Errorf("unexpected reminder %+v", msgs)
+	}
+	op.System = ""
+	if msg := reminders(op, nil)[0]; strings.Contains(msg.Content, " in ") || strings.Contains(msg.Content, "<@") {
+		t.Errorf("unexpected reminder %q", msg.Content)
+	}
+}
+
+func TestReminderSplit(t *testing.T) {
+	starts := time.Date(2022, 3, 5, 19, 0, 0, 0, time.UTC)
+	op := &Op{Title: strings.Repeat("t", MAX_TITLE), Kind: "bgs", Objective: strings.Repeat("ö", MAX_OBJECTIVE), Starts: starts}
+	ids := make([]string, 250)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%019d", i)
+	}
+	msgs := reminders(op, ids)
+	mentioned := 0
+	for i, msg := range msgs {
+		if n := utf8.RuneCountInString(msg.Content); n > MAX_CONTENT {
+			t.Errorf("message %d has %d characters", i, n)
+		}
+		users := msg.AllowedMentions.Users
+		if len(users) > MAX_MENTIONS || strings.Count(msg.Content, "<@") != len(users) {
+			t.Errorf("message %d mentions %d users", i, len(users))
+		}
+		mentioned += len(users)
+	}
+	if mentioned != len(ids) || !strings.HasPrefix(msgs[0].Content, "**ttt") || !strings.HasPrefix(msgs[1].Content, "<@") {
+		t.Errorf("unexpected reminder of %d messages", len(msgs))
+	}
+}
+
+type fakeWebhook struct {
+	status   int
+	received []*webhookMessage
+}
+
+func (f *fakeWebhook) Do(req *http.Request) (*http.Response, error) {
+	msg := &webhookMessage{}
+	if err := json.NewDecoder(req.Body).Decode(msg); err != nil {
+		return nil, err
+	}
+	f.received = append(f.received, msg)
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(f.status)
+	return rec.Result(), nil
+}
+
+func TestPost(t *testing.T) {
+	hook := &fakeWebhook{status: http.StatusNoContent}
+	m := NewOpsModule(hook, nil, &config.Config{OpsWebhook: "https://discord.test/api/webhooks/1/x"})
+	msg := &webhookMessage{Content: "hello <@1>", AllowedMentions: allowedMentions{Users: []string{"1"}}}
+	if err := m.post(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.received) != 1 || hook.received[0].Content != "hello <@1>" || hook.received[0].AllowedMentions.Users[0] != "1" {
+		t.Errorf("unexpected webhook messages %+v", hook.received)
+	}
+	hook.status = http.StatusTooManyRequests
+	if err := m.post(context.Background(), &webhookMessage{Content: "hello"}); err == nil {
+		t.Error("failed webhook request is not an error")
+	}
+}
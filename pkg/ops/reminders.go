@@ -0,0 +1,231 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// How often to look for ops starting soon
+const REMIND_CHECK_INTERVAL = time.Minute
+
+// Discord allows mentioning this many users in one message
+const MAX_MENTIONS = 100
+
+// Discord rejects messages with longer content
+const MAX_CONTENT = 2000
+
+// Failed reminders are posted again after this long
+const REMIND_RETRY_INTERVAL = 5 * time.Minute
+
+const REMINDER_TIME = "2006-01-02 15:04 MST"
+
+type allowedMentions struct {
+	Users []string `json:"users"`
+}
+
+type webhookMessage struct {
+	Content         string          `json:"content"`
+	AllowedMentions allowedMentions `json:"allowed_mentions"`
+}
+
+// Reminder messages of op, mentioning members by discord id. Mentions
+// which do not fit into the first message follow in further ones.
+func reminders(op *Op, discordIds []string) []*webhookMessage {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** (%s) starts %s", op.Title, op.Kind, op.Starts.UTC().Format(REMINDER_TIME))
+	if op.System != "" {
+		fmt.Fprintf(&b, " in %s", op.System)
+	}
+	fmt.Fprintf(&b, "\n%s", op.Objective)
+	msg := &webhookMessage{Content: truncate(b.String(), MAX_CONTENT)}
+	out := []*webhookMessage{msg}
+	length := utf8.RuneCountInString(msg.Content)
+	for _, id := range discordIds {
+		mention := "<@" + id + ">"
+		sep := " "
+		if len(msg.AllowedMentions.Users) == 0 {
+			sep = "\n"
+		}
+		if len(msg.AllowedMentions.Users) == MAX_MENTIONS || length+len(sep)+len(mention) > MAX_CONTENT {
+			msg = &webhookMessage{}
+			out = append(out, msg)
+			length = 0
+		}
+		if length == 0 {
+			sep = ""
+		}
+		msg.Content += sep + mention
+		msg.AllowedMentions.Users = append(msg.AllowedMentions.Users, id)
+		length += len(sep) + len(mention)
+	}
+	return out
+}
+
+// Cut s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+func (m *OpsModule) remindLoop(ctx context.Context) {
+	ticker := time.NewTicker(REMIND_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		n, err := m.RemindDue(ctx)
+		if err != nil {
+			log.Println("ops reminders:", err)
+		} else if n > 0 {
+			log.Println("ops reminders sent:", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Remind members of every scheduled op starting within the configured
+// lead time. Ops are locked one by one, so several replicas can run it at once.
+// Ops whose reminder could not be posted are tried again on a later run.
+func (m *OpsModule) RemindDue(ctx context.Context) (int, error) {
+	ctx, span := tracer.NewSpan(ctx, "ops.remind_due", nil)
+	defer span.End()
+	count := 0
+	for {
+		done, sent, err := m.remindNext(ctx)
+		if err != nil {
+			tracer.AddSpanError(span, err)
+			tracer.FailSpan(span, "reminder error")
+			return count, err
+		}
+		if done {
+			return count, nil
+		}
+		if sent {
+			count++
+		}
+	}
+}
+
+func (m *OpsModule) remindNext(ctx context.Context) (bool, bool, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback(ctx)
+	now := time.Now()
+	op, err := scan(tx.QueryRow(ctx, `
+	SELECT `+columns+`, `+signedUp+` FROM ops
+	WHERE status = $1 AND reminded IS NULL AND starts > $2 AND starts <= $3
+	AND (remind_failed IS NULL OR remind_failed < $4)
+	ORDER BY starts
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+	`, STATUS_SCHEDULED, now, now.Add(m.config.OpsReminder), now.Add(-REMIND_RETRY_INTERVAL)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	ids, err := m.discordIds(ctx, op.Id, tx)
+	if err != nil {
+		return false, false, err
+	}
+	span := tracer.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int64("op.id", int64(op.Id)),
+		attribute.Int("op.mentions", len(ids)),
+	)
+	messages := reminders(op, ids)
+	if err = m.post(ctx, messages[0]); err != nil {
+		// record failure and go on with other ops
+		log.Printf("ops reminder of op %d failed: %v", op.Id, err)
+		tracer.AddSpanError(span, err)
+		if _, err = tx.Exec(ctx, `UPDATE ops SET remind_failed = now() WHERE id = $1`, op.Id); err != nil {
+			return false, false, err
+		}
+		return false, false, tx.Commit(ctx)
+	}
+	// the reminder is out, so missed mentions are not worth posting it twice
+	for _, msg := range messages[1:] {
+		if err = m.post(ctx, msg); err != nil {
+			log.Printf("ops reminder mentions of op %d failed: %v", op.Id, err)
+			tracer.AddSpanError(span, err)
+		}
+	}
+	_, err = tx.Exec(ctx, `UPDATE ops SET reminded = now(), remind_failed = NULL WHERE id = $1`, op.Id)
+	if err != nil {
+		return false, false, err
+	}
+	return false, true, tx.Commit(ctx)
+}
+
+// Discord ids of members signed up for op, members without
+// a linked discord account are left out.
+func (m *OpsModule) discordIds(ctx context.Context, id uint64, tx pgx.Tx) ([]string, error) {
+	out := make([]string, 0)
+	rows, err := tx.Query(ctx, `
+	SELECT DISTINCT d.discord_id FROM op_signups s
+	JOIN discord_accounts d ON d.user_id = s.user_id
+	WHERE s.op_id = $1
+	ORDER BY d.discord_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var discordId string
+		if err = rows.Scan(&discordId); err != nil {
+			return nil, err
+		}
+		out = append(out, discordId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Post message to the ops webhook, pinging only users of its allowed mentions.
+func (m *OpsModule) post(ctx context.Context, msg *webhookMessage) error {
+	if msg.AllowedMentions.Users == nil {
+		msg.AllowedMentions.Users = []string{}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", m.config.OpsWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("ops webhook request failed: %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/api"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/discord"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/tracer"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var MODULE_NAME = "rules"
+
+var ErrInvalidRule = errors.New("invalid rule")
+
+func NewRuleModule(dm *discord.DiscordModule, cfg *config.Config) *RuleModule {
+	return &RuleModule{
+		discord: dm,
+		config:  cfg,
+	}
+}
+
+// Maps discord guild roles of users to admin flag and state
+// of their principals.
+type RuleModule struct {
+	discord *discord.DiscordModule
+	config  *config.Config
+}
+
+func (m *RuleModule) Start(ctx context.Context) error {
+	return nil
+}
+
+// Check that rule can be evaluated: its guild is synced and
+// effect is known.
+func (m *RuleModule) Validate(rule *items.RoleRule) error {
+	tracked := false
+	for _, guild := range m.config.DiscordGuilds {
+		if guild == rule.GuildId {
+			tracked = true
+		}
+	}
+	if !tracked {
+		return fmt.Errorf("%w: guild %s is not synced", ErrInvalidRule, rule.GuildId)
+	}
+	if rule.Absent && rule.RoleId != "" {
+		return fmt.Errorf("%w: absent rule cannot match a role", ErrInvalidRule)
+	}
+	switch rule.Effect {
+	case items.RuleEffectAdmin:
+		if rule.Absent {
+			return fmt.Errorf("%w: admin cannot be granted for absence", ErrInvalidRule)
+		}
+		if rule.State != "" {
+			return fmt.Errorf("%w: admin rule cannot set state", ErrInvalidRule)
+		}
+	case items.RuleEffectState:
+		if rule.State != items.StatePending && rule.State != items.StateApproved {
+			return fmt.Errorf("%w: state must be %s or %s", ErrInvalidRule, items.StatePending, items.StateApproved)
+		}
+	default:
+		return fmt.Errorf("%w: unknown effect %s", ErrInvalidRule, rule.Effect)
+	}
+	return nil
+}
+
+func (m *RuleModule) Create(ctx context.Context, rule *items.RoleRule, tx pgx.Tx) error {
+	if err := m.Validate(rule); err != nil {
+		return err
+	}
+	now := time.Now()
+	rule.Created = &now
+	return tx.QueryRow(ctx, `
+	INSERT INTO role_rules (
+		guild_id, role_id, absent, effect, state, priority, created
+	) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6, $7)
+	RETURNING id
+	`, rule.GuildId, rule.RoleId, rule.Absent, rule.Effect, rule.State,
+		rule.Priority, rule.Created,
+	).Scan(&rule.Id)
+}
+
+// Every rule in evaluation order.
+func (m *RuleModule) List(ctx context.Context, db api.DbConn) ([]*items.RoleRule, error) {
+	out := make([]*items.RoleRule, 0)
+	rows, err := db.Query(ctx, `
+	SELECT id, guild_id, COALESCE(role_id, ''), absent, effect,
+		COALESCE(state, ''), priority, created
+	FROM role_rules
+	ORDER BY priority, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rule := &items.RoleRule{}
+		err = rows.Scan(
+			&rule.Id,
+			&rule.GuildId,
+			&rule.RoleId,
+			&rule.Absent,
+			&rule.Effect,
+			&rule.State,
+			&rule.Priority,
+			&rule.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *RuleModule) Delete(ctx context.Context, id uint64, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM role_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Whether rule matches user with given guild memberships.
+func Matches(rule *items.RoleRule, guilds []*items.DiscordGuildMember) bool {
+	usr := &items.User{Guilds: guilds}
+	if rule.Absent {
+		return !usr.IsGuildMember(rule.GuildId)
+	}
+	if rule.RoleId == "" {
+		return usr.IsGuildMember(rule.GuildId)
+	}
+	return usr.HasGuildRole(rule.GuildId, rule.RoleId)
+}
+
+// Changes rules make to principal. First matching rule of each effect
+// wins. Admin is only revoked when it was granted by a rule, and
+// blocked principals are never touched.
+func Evaluate(rules []*items.RoleRule, p *items.Principal, adminByRule bool, guilds []*items.DiscordGuildMember) []*items.PrincipalChange {
+	out := make([]*items.PrincipalChange, 0)
+	if p.State == items.StateBlocked {
+		return out
+	}
+	var admin, state *items.RoleRule
+	for _, rule := range rules {
+		if !Matches(rule, guilds) {
+			continue
+		}
+		if rule.Effect == items.RuleEffectAdmin && admin == nil {
+			admin = rule
+		}
+		if rule.Effect == items.RuleEffectState && state == nil {
+			state = rule
+		}
+	}
+	if admin != nil && !p.Admin {
+		out = append(out, &items.PrincipalChange{
+			PrincipalId: p.Id,
+			Field:       items.RuleEffectAdmin,
+			OldValue:    "false",
+			NewValue:    "true",
+			RuleId:      &admin.Id,
+		})
+	}
+	if admin == nil && p.Admin && adminByRule {
+		out = append(out, &items.PrincipalChange{
+			PrincipalId: p.Id,
+			Field:       items.RuleEffectAdmin,
+			OldValue:    "true",
+			NewValue:    "false",
+		})
+	}
+	if state != nil && state.State != p.State {
+		out = append(out, &items.PrincipalChange{
+			PrincipalId: p.Id,
+			Field:       items.RuleEffectState,
+			OldValue:    p.State,
+			NewValue:    state.State,
+			RuleId:      &state.Id,
+		})
+	}
+	return out
+}
+
+type subject struct {
+	userId      uint64
+	principal   *items.Principal
+	adminByRule bool
+}
+
+// Evaluate stored rules for user and apply resulting changes, recording
+// each in the audit log. Users without discord accounts are left alone.
+func (m *RuleModule) Apply(ctx context.Context, userId uint64, tx pgx.Tx) ([]*items.PrincipalChange, error) {
+	ctx, span := tracer.NewSpan(ctx, "rules.apply", nil)
+	defer span.End()
+	rules, err := m.List(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	sub := subject{userId: userId, principal: &items.Principal{}}
+	var linked bool
+	err = tx.QueryRow(ctx, `
+	SELECT p.id, p.is_admin, p.state, p.admin_by_rule,
+		EXISTS (SELECT 1 FROM discord_accounts WHERE user_id = u.id)
+	FROM users u
+	JOIN principals p ON p.id = u.principal_id
+	WHERE u.id = $1
+	FOR UPDATE OF p
+	`, userId).Scan(
+		&sub.principal.Id,
+		&sub.principal.Admin,
+		&sub.principal.State,
+		&sub.adminByRule,
+		&linked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !linked {
+		return nil, nil
+	}
+	changes, err := m.evaluate(ctx, rules, &sub, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range changes {
+		switch ch.Field {
+		case items.RuleEffectAdmin:
+			admin, _ := strconv.ParseBool(ch.NewValue)
+			_, err = tx.Exec(ctx, `
+			UPDATE principals SET is_admin = $2, admin_by_rule = $2 WHERE id = $1
+			`, ch.PrincipalId, admin)
+		case items.RuleEffectState:
+			_, err = tx.Exec(ctx, `
+			UPDATE principals SET state = $2 WHERE id = $1
+			`, ch.PrincipalId, ch.NewValue)
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO principal_audit (
+			principal_id, field, old_value, new_value, rule_id, created
+		) VALUES ($1, $2, $3, $4, $5, now())
+		`, ch.PrincipalId, ch.Field, ch.OldValue, ch.NewValue, ch.RuleId)
+		if err != nil {
+			return nil, err
+		}
+		span.AddEvent("principal changed", trace.WithAttributes(
+			attribute.Int64("principal.id", int64(ch.PrincipalId)),
+			attribute.String("field", ch.Field),
+			attribute.String("value", ch.NewValue),
+		))
+	}
+	return changes, nil
+}
+
+// Changes rules would make to every user with a discord account,
+// without applying them. Stored rules are used when rules is nil.
+func (m *RuleModule) DryRun(ctx context.Context, rules []*items.RoleRule, db api.DbConn) ([]*items.PrincipalChange, error) {
+	ctx, span := tracer.NewSpan(ctx, "rules.dry_run", nil)
+	defer span.End()
+	var err error
+	if rules == nil {
+		rules, err = m.List(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range rules {
+		if err = m.Validate(rule); err != nil {
+			return nil, err
+		}
+	}
+	subjects := make([]*subject, 0)
+	rows, err := db.Query(ctx, `
+	SELECT u.id, p.id, p.is_admin, p.state, p.admin_by_rule
+	FROM users u
+	JOIN principals p ON p.id = u.principal_id
+	WHERE EXISTS (SELECT 1 FROM discord_accounts WHERE user_id = u.id)
+	ORDER BY u.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sub := &subject{principal: &items.Principal{}}
+		err = rows.Scan(
+			&sub.userId,
+			&sub.principal.Id,
+			&sub.principal.Admin,
+			&sub.principal.State,
+			&sub.adminByRule,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]*items.PrincipalChange, 0)
+	for _, sub := range subjects {
+		changes, err := m.evaluate(ctx, rules, sub, db)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, changes...)
+	}
+	return out, nil
+}
+
+func (m *RuleModule) evaluate(ctx context.Context, rules []*items.RoleRule, sub *subject, db api.DbConn) ([]*items.PrincipalChange, error) {
+	guilds, err := m.discord.FindGuilds(ctx, sub.userId, db)
+	if err != nil {
+		return nil, err
+	}
+	changes := Evaluate(rules, sub.principal, sub.adminByRule, guilds)
+	for _, ch := range changes {
+		ch.UserId = sub.userId
+	}
+	return changes, nil
+}
+
+// Automatic changes of principal, newest first.
+func (m *RuleModule) Audit(ctx context.Context, principalId uint64, db api.DbConn) ([]*items.PrincipalChange, error) {
+	out := make([]*items.PrincipalChange, 0)
+	rows, err := db.Query(ctx, `
+	SELECT principal_id, field, old_value, new_value, rule_id, created
+	FROM principal_audit
+	WHERE principal_id = $1
+	ORDER BY created DESC, id DESC
+	`, principalId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ch := &items.PrincipalChange{}
+		err = rows.Scan(&ch.PrincipalId, &ch.Field, &ch.OldValue, &ch.NewValue, &ch.RuleId, &ch.Created)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
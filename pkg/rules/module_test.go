@@ -0,0 +1,71 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Close-Encounters-Corps/cec-core/pkg/config"
+	"github.com/Close-Encounters-Corps/cec-core/pkg/items"
+)
+
+var testRules = []*items.RoleRule{
+	{Id: 1, GuildId: "100", RoleId: "officer", Effect: items.RuleEffectAdmin},
+	{Id: 2, GuildId: "100", RoleId: "member", Effect: items.RuleEffectState, State: items.StateApproved},
+	{Id: 3, GuildId: "100", Absent: true, Effect: items.RuleEffectState, State: items.StatePending},
+}
+
+func member(roles ...string) []*items.DiscordGuildMember {
+	return []*items.DiscordGuildMember{{GuildId: "100", Roles: roles}}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := &items.Principal{Id: 1, State: items.StatePending}
+	changes := Evaluate(testRules, p, false, member("officer", "member"))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Field != items.RuleEffectAdmin || changes[0].NewValue != "true" || *changes[0].RuleId != 1 {
+		t.Errorf("unexpected admin change %+v", changes[0])
+	}
+	if changes[1].Field != items.RuleEffectState || changes[1].NewValue != items.StateApproved {
+		t.Errorf("unexpected state change %+v", changes[1])
+	}
+	// left guild: admin granted by rule is revoked, state is reset
+	p = &items.Principal{Id: 1, Admin: true, State: items.StateApproved}
+	changes = Evaluate(testRules, p, true, nil)
+	if len(changes) != 2 || changes[0].NewValue != "false" || changes[1].NewValue != items.StatePending {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	// manual admin is kept
+	changes = Evaluate(testRules, p, false, member("member"))
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+	// blocked principals are left alone
+	p = &items.Principal{Id: 1, State: items.StateBlocked}
+	changes = Evaluate(testRules, p, false, member("officer"))
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := NewRuleModule(nil, &config.Config{DiscordGuilds: []string{"100"}})
+	for _, rule := range testRules {
+		if err := m.Validate(rule); err != nil {
+			t.Errorf("rule %d: %s", rule.Id, err)
+		}
+	}
+	invalid := []*items.RoleRule{
+		{GuildId: "200", Effect: items.RuleEffectAdmin},
+		{GuildId: "100", Absent: true, Effect: items.RuleEffectAdmin},
+		{GuildId: "100", Absent: true, RoleId: "member", Effect: items.RuleEffectState, State: items.StatePending},
+		{GuildId: "100", Effect: items.RuleEffectState, State: items.StateBlocked},
+		{GuildId: "100", Effect: "owner"},
+	}
+	for i, rule := range invalid {
+		if err := m.Validate(rule); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("rule %d: expected invalid rule, got %v", i, err)
+		}
+	}
+}
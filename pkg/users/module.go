@@ -2,6 +2,7 @@ package users
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -15,6 +16,8 @@ import (
 
 var MODULE_NAME = "users"
 
+var ErrSelfMerge = errors.New("cannot merge user into itself")
+
 func NewUserModule(pm *principal.PrincipalModule) *UserModule {
 	return &UserModule{
 		pm: pm,
@@ -136,3 +139,82 @@ func (m *UserModule) FindAll(ctx context.Context, ids []uint64, detailed bool, t
 func (m *UserModule) Save(ctx context.Context, user *items.User, tx api.DbConn) error {
 	return m.pm.Save(ctx, user.Principal, tx)
 }
+
+// Change state of user's principal.
+func (m *UserModule) SetState(ctx context.Context, id uint64, state string, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `
+	UPDATE principals SET state = $2
+	WHERE id = (SELECT principal_id FROM users WHERE id = $1)
+	`, id, state)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Count accounts user can log in with.
+func (m *UserModule) LoginMethods(ctx context.Context, id uint64, db api.DbConn) (int, error) {
+	var count int
+	err := db.QueryRow(ctx, `
+	SELECT
+		(SELECT count(*) FROM discord_accounts WHERE user_id = $1) +
+		(SELECT count(*) FROM frontier_accounts WHERE user_id = $1)
+	`, id).Scan(&count)
+	return count, err
+}
+
+// Move accounts, op signups and authored rows of source user to target
+// and block source principal. Journal commanders follow their frontier
+// accounts. Where both users signed up for an op, target's signup is kept
+// and attendance of either counts.
+func (m *UserModule) Merge(ctx context.Context, target uint64, source uint64, tx pgx.Tx) error {
+	if target == source {
+		return ErrSelfMerge
+	}
+	src, err := m.FindOne(ctx, source, tx)
+	if err != nil {
+		return err
+	}
+	if _, err = m.FindOne(ctx, target, tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE op_signups t SET attended = COALESCE(t.attended OR s.attended, t.attended, s.attended)
+	FROM op_signups s
+	WHERE t.user_id = $1 AND s.user_id = $2 AND s.op_id = t.op_id
+	`, target, source)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	DELETE FROM op_signups s
+	WHERE s.user_id = $2 AND EXISTS (
+		SELECT 1 FROM op_signups t WHERE t.user_id = $1 AND t.op_id = s.op_id
+	)
+	`, target, source)
+	if err != nil {
+		return err
+	}
+	moves := []struct{ table, column string }{
+		{"discord_accounts", "user_id"},
+		{"frontier_accounts", "user_id"},
+		{"op_signups", "user_id"},
+		{"ops", "created_by"},
+		{"ops", "reported_by"},
+		{"faction_influence", "submitted_by"},
+	}
+	for _, mv := range moves {
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s SET %s = $1 WHERE %s = $2
+		`, mv.table, mv.column, mv.column), target, source)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("merged user %v into %v\n", source, target)
+	src.Principal.State = items.StateBlocked
+	return m.pm.Save(ctx, src.Principal, tx)
+}